@@ -40,7 +40,7 @@ func connect(conf config.Cache) error {
 }
 
 func Connect(name string, opts ...Option) error {
-	list := config.GetConfig().Cache
+	list := config.Get().Cache
 	for _, v := range list {
 		if v.Name == name {
 			for _, o := range opts {
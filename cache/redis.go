@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/liuyp5181/base/config"
+	"github.com/liuyp5181/base/tracing"
 	"reflect"
 )
 
@@ -21,6 +22,9 @@ func ConnectRedis(cfg config.Cache) error {
 		return err
 	}
 
+	if tracing.Enabled() {
+		c.AddHook(tracingHook{addr: c.Options().Addr, db: cfg.DB})
+	}
 	redisList[cfg.Name] = c
 	return nil
 }
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/liuyp5181/base/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingHook starts a span for every command and pipeline, only the command names are recorded
+// so that keys and values do not leak into the traces
+type tracingHook struct {
+	addr string
+	db   int
+}
+
+func (h tracingHook) start(ctx context.Context, name, statement string) context.Context {
+	ctx, _ = tracing.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "redis"),
+		attribute.Int("db.redis.database_index", h.db),
+		attribute.String("net.peer.name", h.addr),
+		attribute.String("db.statement", statement),
+	))
+	return ctx
+}
+
+func (h tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.start(ctx, "redis."+cmd.Name(), cmd.Name()), nil
+}
+
+func (h tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	end(ctx, cmd.Err())
+	return nil
+}
+
+func (h tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	var names string
+	for i, cmd := range cmds {
+		if i > 0 {
+			names += " "
+		}
+		names += cmd.Name()
+	}
+	return h.start(ctx, "redis.pipeline", names), nil
+}
+
+func (h tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && !errors.Is(cmd.Err(), redis.Nil) {
+			err = cmd.Err()
+			break
+		}
+	}
+	end(ctx, err)
+	return nil
+}
+
+func end(ctx context.Context, err error) {
+	if errors.Is(err, redis.Nil) {
+		err = nil
+	}
+	tracing.End(trace.SpanFromContext(ctx), err)
+}
@@ -7,8 +7,10 @@ import (
 	"github.com/spf13/viper"
 	"reflect"
 	"sync"
+	"time"
 
 	pb "github.com/liuyp5181/base/client/configmgr/api"
+	"github.com/liuyp5181/base/config"
 	"github.com/liuyp5181/base/log"
 	"github.com/liuyp5181/base/service"
 )
@@ -153,3 +155,100 @@ func Get(group, key string) (interface{}, error) {
 	}
 	return conf, nil
 }
+
+func init() {
+	config.RegisterSource("configmgr", func(r config.Remote) (config.Source, error) {
+		if r.Group == "" || r.Key == "" {
+			return nil, fmt.Errorf("group and key of the configmgr source are required")
+		}
+		return Source(r.Group, r.Key, r.Format), nil
+	})
+}
+
+type source struct {
+	group    string
+	key      string
+	confType string
+}
+
+// Source returns the value at group/key as a layer of the service config, given to config.AddSource
+// before base.Init or listed in the remote section of the config file. The config follows its changes
+func Source(group, key, confType string) config.Source {
+	return &source{group: group, key: key, confType: confType}
+}
+
+func (s *source) Name() string {
+	return fmt.Sprintf("configmgr:%s/%s", s.group, s.key)
+}
+
+func (s *source) Load() (map[string]interface{}, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+	cc, err := service.GetClient(pb.Greeter_ServiceDesc.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.SourceTimeout)
+	defer cancel()
+	resp, err := pb.NewGreeterClient(cc).Get(ctx, &pb.GetReq{Group: s.group, Key: s.key})
+	if err != nil {
+		return nil, err
+	}
+	return s.parse([]byte(resp.Val))
+}
+
+func (s *source) parse(val []byte) (map[string]interface{}, error) {
+	m, ok := config.ParseValue(val, s.confType).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("read config failed, not a %s document, extend=[%s]", s.confType, string(val))
+	}
+	return m, nil
+}
+
+func (s *source) Watch(ctx context.Context, update func(settings map[string]interface{})) {
+	for ctx.Err() == nil {
+		if err := s.watch(ctx, update); err != nil && ctx.Err() == nil {
+			log.Errorf("watch config %s failed, err = %v", s.Name(), err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(config.SourceRetryInterval):
+		}
+	}
+}
+
+func (s *source) watch(ctx context.Context, update func(settings map[string]interface{})) error {
+	cc, err := service.GetClient(pb.Greeter_ServiceDesc.ServiceName)
+	if err != nil {
+		return err
+	}
+	stream, err := pb.NewGreeterClient(cc).Watch(ctx, &pb.WatchReq{Group: s.group, Key: s.key})
+	if err != nil {
+		return err
+	}
+	// the changes made before the stream was open
+	if m, err := s.Load(); err == nil {
+		update(m)
+	}
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if res.Group != s.group || res.Key != s.key {
+			continue
+		}
+		switch res.Type {
+		case pb.WatchType_PUT:
+			m, err := s.parse(res.Val)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			update(m)
+		case pb.WatchType_DELETE:
+			update(map[string]interface{}{})
+		}
+	}
+}
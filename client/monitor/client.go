@@ -2,27 +2,57 @@ package monitor
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/liuyp5181/base/config"
+	"github.com/liuyp5181/base/etcd"
 	"github.com/liuyp5181/base/service"
+	"github.com/liuyp5181/base/service/schema"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"strings"
 
 	pb "github.com/liuyp5181/base/client/monitor/api"
 )
 
 const defaultMonitorPort = 6226
 
-var monitorPort = defaultMonitorPort
+var (
+	monitorPort = defaultMonitorPort
+	descFiles   string
+)
 
 func init() {
 	flag.IntVar(&monitorPort, "moPort", defaultMonitorPort, "monitor port")
+	flag.StringVar(&descFiles, "moDescriptors", "", "descriptor set files served as OpenAPI/JSON Schema, comma separated")
 }
 
 func Register() error {
 	//提供 /metrics HTTP 端点
 	http.Handle("/metrics", promhttp.Handler())
+
+	// 提供 /openapi/<service>.json 和 /schema/<message>.json
+	r := schema.NewLocalResolver()
+	if descFiles != "" {
+		if err := r.LoadFiles(strings.Split(descFiles, ",")...); err != nil {
+			return err
+		}
+	}
+	h := schema.NewHandler(r)
+	http.Handle(schema.OpenAPIPath, h)
+	http.Handle(schema.SchemaPath, h)
+
+	// 提供 /leaders，本进程参与的选举及当前 leader
+	http.HandleFunc("/leaders", func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.MarshalIndent(etcd.Elections(r.Context()), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
 	go func() {
 		err := http.ListenAndServe(fmt.Sprintf(":%d", monitorPort), nil)
 		if err != nil {
@@ -0,0 +1,371 @@
+// basectl lists, inspects and calls the services registered in etcd.
+//
+//	basectl [-conf config.yaml] list [service]
+//	basectl [-conf config.yaml] describe [-addr ip:port] <service> [method|message]
+//	basectl [-conf config.yaml] call [-addr ip:port] [-d json] [-H key:value] [-v] <service>/<method>
+//	basectl [-conf config.yaml] watch [service]
+//	basectl keygen
+//	basectl encrypt [-key-file file] [value]
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoprint"
+	"github.com/liuyp5181/base"
+	"github.com/liuyp5181/base/config"
+	"github.com/liuyp5181/base/etcd"
+	"github.com/liuyp5181/base/service/proxy"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const usage = `usage: basectl [-conf config.yaml] <command> [arguments]
+
+commands:
+  list     [service]                                   list registered services and instances
+  describe [-addr ip:port] <service> [method|message]  describe a service, method or message
+  call     [-addr ip:port] [-d json] [-H key:value] [-v] <service>/<method>
+                                                       call a method with JSON input, "-d @file" reads a file, "-d -" stdin
+  watch    [service]                                   watch membership changes
+  keygen                                               print a new key for the ENC(...) config values
+  encrypt  [-key-file file] [value]                    encrypt a config value, read from stdin without value.
+                                                       the key is -key-file, $APP_CONFIG_KEY_FILE or $APP_CONFIG_KEY
+`
+
+type headers []string
+
+func (h *headers) String() string {
+	return strings.Join(*h, ",")
+}
+
+func (h *headers) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// keygen and encrypt work without the config file and etcd
+	if args[0] != "keygen" && args[0] != "encrypt" {
+		base.Init()
+	}
+
+	var err error
+	switch args[0] {
+	case "keygen":
+		err = keygen()
+	case "encrypt":
+		err = encrypt(args[1:])
+	case "list":
+		err = list(args[1:])
+	case "describe":
+		err = describe(args[1:])
+	case "call":
+		err = call(args[1:])
+	case "watch":
+		err = watch(args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func list(args []string) error {
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	}
+	services, err := etcd.GetService(name)
+	if err != nil {
+		return err
+	}
+
+	var group = make(map[string][]etcd.Service)
+	var names []string
+	for _, s := range services {
+		if _, ok := group[s.Name]; !ok {
+			names = append(names, s.Name)
+		}
+		group[s.Name] = append(group[s.Name], s)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		fmt.Printf("%s (%d instances)\n", n, len(group[n]))
+		for _, s := range group[n] {
+			fmt.Printf("  %s:%d\tversion=%s\tpower=%d\n", s.IP, s.Port, s.Version, s.Power)
+		}
+	}
+	return nil
+}
+
+// connect opens a proxy to addr, or to the first instance of the service when addr is empty
+func connect(ctx context.Context, name, addr string) (*proxy.Proxy, error) {
+	if addr == "" {
+		services, err := etcd.GetService(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range services {
+			if s.Name == name {
+				addr = fmt.Sprintf("%s:%d", s.IP, s.Port)
+				break
+			}
+		}
+		if addr == "" {
+			return nil, fmt.Errorf("service %s has no instance", name)
+		}
+	}
+	return proxy.NewConnect(ctx, addr)
+}
+
+func describe(args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	addr := fs.String("addr", "", "instance address ip:port, default the first registered instance")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("describe needs a service name")
+	}
+	name := fs.Arg(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p, err := connect(ctx, name, *addr)
+	if err != nil {
+		return err
+	}
+	defer p.CloseConn()
+
+	sd, err := p.ResolveService(ctx, name)
+	if err != nil {
+		return err
+	}
+	var d desc.Descriptor = sd.ServiceDescriptor
+	if fs.NArg() > 1 {
+		symbol := fs.Arg(1)
+		if md := sd.ServiceDescriptor.FindMethodByName(symbol); md != nil {
+			return printMethod(md)
+		}
+		msg, err := p.ResolveMessage(ctx, symbol)
+		if err != nil {
+			return fmt.Errorf("%s is neither a method of %s nor a message", symbol, name)
+		}
+		d = msg.AsProtoreflectDescriptor()
+	}
+	return printDescriptor(d)
+}
+
+func printMethod(md *desc.MethodDescriptor) error {
+	if err := printDescriptor(md); err != nil {
+		return err
+	}
+	if err := printDescriptor(md.GetInputType()); err != nil {
+		return err
+	}
+	return printDescriptor(md.GetOutputType())
+}
+
+func printDescriptor(d desc.Descriptor) error {
+	s, err := (&protoprint.Printer{Compact: true}).PrintProtoToString(d)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("// %s\n%s\n", d.GetFullyQualifiedName(), s)
+	return nil
+}
+
+func call(args []string) error {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	addr := fs.String("addr", "", "instance address ip:port, default the first registered instance")
+	data := fs.String("d", "{}", "JSON request, @file reads a file and - reads stdin")
+	verbose := fs.Bool("v", false, "print response headers and trailers")
+	timeout := fs.Duration("timeout", 10*time.Second, "call timeout")
+	var hs headers
+	fs.Var(&hs, "H", "request metadata key:value, repeatable")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("call needs <service>/<method>")
+	}
+
+	target := fs.Arg(0)
+	i := strings.LastIndexAny(target, "/.")
+	if i <= 0 || i == len(target)-1 {
+		return fmt.Errorf("invalid method %s, use <service>/<method>", target)
+	}
+	name, method := target[:i], target[i+1:]
+
+	input, err := readInput(*data)
+	if err != nil {
+		return err
+	}
+
+	var md = metadata.MD{}
+	for _, h := range hs {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid header %s, use key:value", h)
+		}
+		md.Append(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	p, err := connect(ctx, name, *addr)
+	if err != nil {
+		return err
+	}
+	defer p.CloseConn()
+
+	res, err := p.Invoke(ctx, name, method, input, md)
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		printMetadata("header", res.Header)
+		printMetadata("trailer", res.Trailer)
+	}
+	if res.Code != codes.OK {
+		b, _ := res.StatusJSON()
+		return fmt.Errorf("%s %s", res.Code, indent(b))
+	}
+	fmt.Println(indent(res.Response))
+	return nil
+}
+
+func readInput(data string) ([]byte, error) {
+	switch {
+	case data == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+func printMetadata(kind string, md metadata.MD) {
+	var keys []string
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range md[k] {
+			fmt.Printf("%s %s: %s\n", kind, k, v)
+		}
+	}
+}
+
+func indent(b []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return string(b)
+	}
+	return buf.String()
+}
+
+func watch(args []string) error {
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if name == "" {
+		fmt.Println("watching all services")
+	} else {
+		fmt.Println("watching", name)
+	}
+	for wresp := range etcd.WatcherService(context.Background(), name) {
+		if err := wresp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range wresp.Events {
+			ts := time.Now().Format("2006-01-02 15:04:05")
+			switch ev.Type {
+			case mvccpb.PUT:
+				var s etcd.Service
+				if err := json.Unmarshal(ev.Kv.Value, &s); err != nil {
+					fmt.Printf("%s PUT    %s invalid value: %s\n", ts, ev.Kv.Key, ev.Kv.Value)
+					continue
+				}
+				fmt.Printf("%s PUT    %s %s:%d version=%s power=%d\n", ts, s.Name, s.IP, s.Port, s.Version, s.Power)
+			case mvccpb.DELETE:
+				fmt.Printf("%s DELETE %s\n", ts, ev.Kv.Key)
+			}
+		}
+	}
+	return nil
+}
+
+func keygen() error {
+	key, err := config.GenerateKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+func encrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	keyFile := fs.String("key-file", "", "key file, default $APP_CONFIG_KEY_FILE or $APP_CONFIG_KEY")
+	fs.Parse(args)
+
+	key, err := encryptKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	var value string
+	if fs.NArg() > 0 {
+		value = fs.Arg(0)
+	} else {
+		// read from stdin so that the secret is not kept in the shell history
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	enc, err := config.EncryptValue(key, value)
+	if err != nil {
+		return err
+	}
+	fmt.Println(enc)
+	return nil
+}
+
+func encryptKey(file string) ([]byte, error) {
+	if file == "" {
+		return config.LoadKey()
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return config.ParseKey(string(data))
+}
@@ -1,16 +1,15 @@
 package config
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
 	"github.com/liuyp5181/base/etcd"
 	"github.com/liuyp5181/base/log"
+	"github.com/liuyp5181/base/tracing"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
-	clientv3 "go.etcd.io/etcd/client/v3"
-	"io/ioutil"
-	"os"
-	"strings"
+	"reflect"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,137 +18,226 @@ const (
 )
 
 type Global struct {
-	Namespace string `mapstructure:"namespace"`
+	Namespace string `mapstructure:"namespace" validate:"required"`
 }
 
 type Server struct {
 	IP   string `mapstructure:"ip"`
-	Port int    `mapstructure:"port"`
+	Port int    `mapstructure:"port" validate:"min=1,max=65535"`
+	// DisableReflection turns off the gRPC reflection services, e.g. in production
+	DisableReflection bool `mapstructure:"disable_reflection"`
 }
 
 type Database struct {
-	Type string `yaml:"type"`
-	Name string `yaml:"name"`
+	// Type is mysql, postgres, sqlite or a type registered by database.RegisterDriver
+	Type string `yaml:"type" default:"mysql"`
+	Name string `yaml:"name" validate:"required"`
+	// Host is not used by sqlite, Port is 3306 for mysql and 5432 for postgres when 0
 	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Port int    `yaml:"port" validate:"max=65535"`
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+	// DB is the file of sqlite, or :memory:
+	DB string `yaml:"db" validate:"required"`
+
+	// 连接池
+	// MaxOpenConns limits the open connections, unlimited when 0
+	MaxOpenConns int `yaml:"max_open_conns" mapstructure:"max_open_conns" validate:"min=0"`
+	// MaxIdleConns is the number of idle connections kept, 2 when 0 and none when negative
+	MaxIdleConns    int           `yaml:"max_idle_conns" mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" mapstructure:"conn_max_lifetime" validate:"min=0s"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" mapstructure:"conn_max_idle_time" validate:"min=0s"`
+
+	DialTimeout  time.Duration `yaml:"dial_timeout" mapstructure:"dial_timeout" default:"5s" validate:"min=0s"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" mapstructure:"read_timeout" validate:"min=0s"`
+	WriteTimeout time.Duration `yaml:"write_timeout" mapstructure:"write_timeout" validate:"min=0s"`
+
+	// Charset is utf8mb4 when neither it nor Collation is set, a Collation alone also sets its charset
+	Charset   string `yaml:"charset"`
+	Collation string `yaml:"collation"`
+	// TimeZone is the location of the DATETIME values, an IANA name such as Asia/Shanghai, or Local
+	TimeZone string `yaml:"time_zone" mapstructure:"time_zone" default:"Local"`
+	// TLS is true, false, skip-verify, preferred or the name of a config registered with
+	// mysql.RegisterTLSConfig
+	TLS string `yaml:"tls"`
+	// Params are added to the DSN as they are, e.g. sql_mode or interpolateParams
+	Params map[string]string `yaml:"params"`
+
+	// 读写分离，读走从库，写和事务走主库
+	Replicas []Replica `yaml:"replicas"`
+	// Policy picks the replica of a read, random or round_robin
+	Policy string `yaml:"policy" default:"random" validate:"oneof=random round_robin"`
+	// HealthInterval is the period of the pings removing the unhealthy replicas and adding them back
+	HealthInterval time.Duration `yaml:"health_interval" mapstructure:"health_interval" default:"10s" validate:"min=1s"`
+}
+
+// Replica is a read only copy of a database, the empty fields are the ones of the primary
+type Replica struct {
+	Host string `yaml:"host" validate:"required"`
+	Port int    `yaml:"port" validate:"max=65535"`
 	User string `yaml:"user"`
 	Pass string `yaml:"pass"`
-	DB   string `yaml:"db"`
 }
 
 type Cache struct {
-	Type string `yaml:"type"`
-	Name string `yaml:"name"`
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Type string `yaml:"type" default:"redis" validate:"oneof=redis"`
+	Name string `yaml:"name" validate:"required"`
+	Host string `yaml:"host" validate:"required"`
+	Port int    `yaml:"port" default:"6379" validate:"min=1,max=65535"`
 	Pass string `yaml:"pass"`
-	DB   int    `yaml:"db"`
+	DB   int    `yaml:"db" validate:"min=0,max=15"`
 }
 
 type Conf struct {
-	Etcd     []etcd.Config `mapstructure:"etcd"`
-	Log      *log.Config   `mapstructure:"log"`
-	Global   *Global       `mapstructure:"global"`
-	Server   Server        `mapstructure:"server"`
-	Database []Database    `mapstructure:"database"`
-	Cache    []Cache       `mapstructure:"cache"`
+	Etcd     etcd.ClientConfig `mapstructure:"etcd"`
+	Log      *log.Config       `mapstructure:"log"`
+	Trace    *tracing.Config   `mapstructure:"trace"`
+	Global   *Global           `mapstructure:"global" validate:"required"`
+	Server   Server            `mapstructure:"server"`
+	Database []Database        `mapstructure:"database"`
+	Cache    []Cache           `mapstructure:"cache"`
+	Remote   []Remote          `mapstructure:"remote"`
 }
 
 var (
 	confPath    = defaultConfigPath
-	localData   []byte
-	vp          *viper.Viper
-	cfg         Conf
+	watchConf   = true
+	current     atomic.Pointer[snapshot]
 	ServiceName = "Service"
 )
 
+// snapshot is the merged config, replaced as a whole when a layer changes
+type snapshot struct {
+	conf     Conf
+	settings map[string]interface{}
+	origins  map[string]string
+	// secrets are the keys whose values were encrypted
+	secrets map[string]bool
+}
+
 func init() {
 	flag.StringVar(&confPath, "conf", defaultConfigPath, "config file path")
+	flag.StringVar(&confDir, "conf_dir", "", "directory of config files merged after the config file, conf.d next to it by default")
+	flag.BoolVar(&watchConf, "conf_watch", true, "reload the config file when it changes")
+	flag.StringVar(&envName, "env", "", "environment, config.<env>.yaml overlays the config file, $<env_prefix>_ENV by default")
+	flag.StringVar(&envPrefix, "env_prefix", defaultEnvPrefix, "prefix of the environment variables overriding config keys")
+	flag.Var(&setFlags, "set", "override a config key, key=value, may be repeated")
+	flag.StringVar(&keyFile, "conf_key_file", "", "file of the key decrypting the ENC(...) values of the config")
 }
 
 func Init() {
-	data, err := ioutil.ReadFile(confPath)
+	s, err := parse()
 	if err != nil {
-		panic(fmt.Sprintf("read config file failed, config-file=[%s], err_msg=[%s]", confPath, err.Error()))
+		panic(err.Error())
 	}
-	localData = data
+	current.Store(s)
+	cfg := s.conf
 
-	err = readConfig()
-	if err != nil {
-		panic(fmt.Sprintf("readConfig failed, err_msg=[%s], content=[\n%s]", err.Error(), string(localData)))
+	fmt.Printf("config =\n%s", Dump())
+
+	if cfg.Log != nil {
+		err = log.Init(cfg.Log)
+		if err != nil {
+			panic(fmt.Sprintf("init Log failed, config=[%+v], err_msg=[%s]", cfg.Log, err.Error()))
+		}
 	}
 
-	err = vp.Unmarshal(&cfg)
-	if err != nil {
-		panic(fmt.Sprintf("Unmarshal failed, err_msg=[%s] content=[\n%s]", err.Error(), string(localData)))
+	if cfg.Trace != nil {
+		err = tracing.Init(cfg.Trace, ServiceName, cfg.Global.Namespace)
+		if err != nil {
+			panic(fmt.Sprintf("init Trace failed, config=[%+v], err_msg=[%s]", cfg.Trace, err.Error()))
+		}
 	}
 
-	fmt.Println("config = ", string(data))
-	fmt.Println("config = ", cfg)
+	err = etcd.InitConfig(cfg.Etcd)
+	if err != nil {
+		panic(fmt.Sprintf("init Etcd failed, config=[%v], err_msg=[%s]", cfg.Etcd, err.Error()))
+	}
 
-	if cfg.Global.Namespace == "" {
-		panic("namespace is nil")
+	// 远程配置依赖 etcd，在本地配置之后加载
+	if err = initSources(cfg.Remote, watchConf); err != nil {
+		panic(err.Error())
+	}
+	if err = reload(); err != nil {
+		panic(fmt.Sprintf("apply remote config failed, err_msg=[%s]", err.Error()))
 	}
 
-	if cfg.Log != nil {
-		err = log.Init(cfg.Log)
-		if err != nil {
-			panic(fmt.Sprintf("init Log failed, config=[%+v], err_msg=[%s]", cfg.Log, err.Error()))
+	if watchConf {
+		if err = startWatch(); err != nil {
+			log.Errorf("watch config file failed, config-file=[%s], err = %v", confPath, err)
 		}
 	}
+}
 
-	var points []string
-	for _, v := range cfg.Etcd {
-		points = append(points, fmt.Sprintf("%s:%d", v.IP, v.Port))
+// parse merges the layers, fills the defaults and validates the result
+func parse() (*snapshot, error) {
+	layers, err := loadLayers()
+	if err != nil {
+		return nil, err
 	}
 
-	var ec = clientv3.Config{
-		Endpoints:   points,
-		DialTimeout: 5 * time.Second,
+	vp, err := readConfig(mergeLayers(layers))
+	if err != nil {
+		return nil, err
 	}
-	err = etcd.Init(ec)
+	settings := vp.AllSettings()
+	secrets, err := decryptSettings(settings)
 	if err != nil {
-		panic(fmt.Sprintf("init Etcd failed, config=[%+v], err_msg=[%s]", ec, err.Error()))
+		return nil, err
 	}
-}
+	keyOrigins := origins(layers, settings)
+	fillDefaults(reflect.TypeOf(Conf{}), settings, "", keyOrigins)
 
-func readConfig() error {
-	vp = viper.New()
-	vp.SetConfigType("yaml")
-	vp.AutomaticEnv()
-	if err := vp.ReadConfig(bytes.NewReader(localData)); err != nil {
-		return err
+	var cfg Conf
+	if err = decodeAndValidate(settings, &cfg, ""); err != nil {
+		return nil, err
 	}
 
-	for _, k := range vp.AllKeys() {
-		value := vp.GetString(k)
-		if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
-			tp := strings.TrimPrefix(value, "${")
-			ts := strings.TrimSuffix(tp, "}")
-			e := os.Getenv(ts)
-			if len(e) == 0 {
-				return fmt.Errorf("get env fail, key = %v", value)
-			}
-			vp.Set(k, e)
+	return &snapshot{conf: cfg, settings: settings, origins: keyOrigins, secrets: secrets}, nil
+}
+
+// decodeHook adds to the default hooks of viper the conversion of the etcd endpoint list used by
+// older config files to etcd.ClientConfig
+var decodeHook = mapstructure.ComposeDecodeHookFunc(
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+	func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if t == reflect.TypeOf(etcd.ClientConfig{}) && f.Kind() == reflect.Slice {
+			return map[string]interface{}{"endpoints": data}, nil
 		}
+		return data, nil
+	},
+)
+
+// readConfig interpolates the environment variables in the merged settings
+func readConfig(settings map[string]interface{}) (*viper.Viper, error) {
+	if err := interpolateSettings(settings); err != nil {
+		return nil, err
 	}
-	return nil
+	vp := viper.New()
+	if err := vp.MergeConfigMap(settings); err != nil {
+		return nil, fmt.Errorf("readConfig failed, err_msg=[%s]", err.Error())
+	}
+	return vp, nil
 }
 
-// Load config by local config file
+// Load decodes the extend section of the config into conf, fills the default tags of the keys that are
+// not set and checks the validate tags, see Validate
 func Load(conf interface{}) error {
-	var ext = struct {
-		Extend interface{} `mapstructure:"extend"`
-	}{
-		Extend: conf,
-	}
-	if err := vp.Unmarshal(&ext); err != nil {
-		return fmt.Errorf("local config unmarshal failed, err_msg=[%s], content=[\n%s]", err.Error(), string(localData))
+	s := current.Load()
+	if s == nil {
+		return fmt.Errorf("config is not initialized")
 	}
-
-	return nil
+	ext, _ := s.settings["extend"].(map[string]interface{})
+	ext = copyMap(ext)
+	fillDefaults(reflect.TypeOf(conf), ext, "extend", nil)
+	return decodeAndValidate(ext, conf, "extend")
 }
 
+// Get returns the current config, a reload replaces it as a whole so the returned value stays consistent
 func Get() Conf {
-	return cfg
+	if s := current.Load(); s != nil {
+		return s.conf
+	}
+	return Conf{}
 }
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const redacted = "******"
+
+// secretNames are the key names whose values Dump masks, besides the values that were encrypted
+var secretNames = map[string]bool{
+	"pass":        true,
+	"password":    true,
+	"passwd":      true,
+	"secret":      true,
+	"token":       true,
+	"secret_key":  true,
+	"access_key":  true,
+	"private_key": true,
+}
+
+// Dump returns the effective config for logs, one "key = value  # origin" line per key sorted by key.
+// The values of encrypted keys and of keys named like a password are masked
+func Dump() string {
+	s := current.Load()
+	if s == nil {
+		return ""
+	}
+	var lines = map[string]interface{}{}
+	dumpFlatten("", s.settings, lines)
+
+	var keys = make([]string, 0, len(lines))
+	for k := range lines {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		v := lines[k]
+		if s.secrets[k] || secretNames[lastSegment(k)] {
+			v = redacted
+		}
+		fmt.Fprintf(&b, "%s = %v", k, v)
+		if o := originOf(s.origins, k); o != "" {
+			fmt.Fprintf(&b, "  # %s", o)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// dumpFlatten is flatten going into lists, their elements are keyed by key[i]
+func dumpFlatten(prefix string, v interface{}, out map[string]interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			out[prefix] = v
+		}
+		for k, e := range v {
+			dumpFlatten(joinKey(prefix, k), e, out)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			out[prefix] = v
+		}
+		for i, e := range v {
+			dumpFlatten(fmt.Sprintf("%s[%d]", prefix, i), e, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+func lastSegment(key string) string {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		key = key[i+1:]
+	}
+	if i := strings.IndexByte(key, '['); i >= 0 {
+		key = key[:i]
+	}
+	return key
+}
+
+// originOf returns the origin of key or of the nearest parent having one, the origins of lists are
+// kept for the list as a whole
+func originOf(origins map[string]string, key string) string {
+	for key != "" {
+		if o, ok := origins[key]; ok {
+			return o
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return ""
+}
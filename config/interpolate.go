@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The strings of every layer, list elements included, are interpolated with environment variables:
+//
+//	${VAR}           the value of VAR, an error when VAR is unset or empty
+//	${VAR:-default}  default when VAR is unset or empty, ${VAR-default} only when it is unset
+//	${VAR:?message}  an error with message when VAR is unset or empty, ${VAR?message} only when it is unset
+//	$${              a literal ${
+//
+// The default may contain ${...} itself, e.g. "${DB_HOST:-${HOST}}:${DB_PORT:-3306}".
+
+// interpolateSettings interpolates the strings of settings in place and reports every key that fails
+func interpolateSettings(settings map[string]interface{}) error {
+	var errs ValidationError
+	var walk func(v interface{}, path string) interface{}
+	walk = func(v interface{}, path string) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				v[k] = walk(e, joinKey(path, k))
+			}
+		case []interface{}:
+			for i, e := range v {
+				v[i] = walk(e, fmt.Sprintf("%s[%d]", path, i))
+			}
+		case string:
+			s, err := interpolate(v)
+			if err != nil {
+				errs = append(errs, FieldError{Key: path, Message: err.Error()})
+				return v
+			}
+			return s
+		}
+		return v
+	}
+	walk(settings, "")
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func interpolate(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			b.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unclosed ${ in %q", s)
+			}
+			v, err := expand(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = end + 1
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the } closing the ${ before start, or -1
+func closingBrace(s string, start int) int {
+	depth := 1
+	for j := start; j < len(s); j++ {
+		switch {
+		case strings.HasPrefix(s[j:], "${"):
+			depth++
+			j++
+		case s[j] == '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// expand returns the value of the expression between ${ and }
+func expand(expr string) (string, error) {
+	n := 0
+	for n < len(expr) && (expr[n] == '_' || expr[n] >= 'A' && expr[n] <= 'Z' || expr[n] >= 'a' && expr[n] <= 'z' || n > 0 && expr[n] >= '0' && expr[n] <= '9') {
+		n++
+	}
+	if n == 0 {
+		return "", fmt.Errorf("invalid variable name in ${%s}", expr)
+	}
+	name, rest := expr[:n], expr[n:]
+	val, set := os.LookupEnv(name)
+
+	switch {
+	case rest == "":
+		if val == "" {
+			return "", fmt.Errorf("env %s is not set or empty", name)
+		}
+		return val, nil
+	case strings.HasPrefix(rest, ":-"):
+		if val == "" {
+			return interpolate(rest[2:])
+		}
+		return val, nil
+	case strings.HasPrefix(rest, "-"):
+		if !set {
+			return interpolate(rest[1:])
+		}
+		return val, nil
+	case strings.HasPrefix(rest, ":?"):
+		if val == "" {
+			return "", requiredError(name, rest[2:])
+		}
+		return val, nil
+	case strings.HasPrefix(rest, "?"):
+		if !set {
+			return "", requiredError(name, rest[1:])
+		}
+		return val, nil
+	}
+	return "", fmt.Errorf("invalid expression ${%s}", expr)
+}
+
+func requiredError(name, msg string) error {
+	if msg == "" {
+		return fmt.Errorf("env %s is not set", name)
+	}
+	return fmt.Errorf("env %s: %s", name, msg)
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("IT_HOST", "db.local")
+	t.Setenv("IT_PORT", "3307")
+	t.Setenv("IT_EMPTY", "")
+	os.Unsetenv("IT_UNSET")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  string
+	}{
+		{name: "plain", in: "localhost", want: "localhost"},
+		{name: "dollar without brace", in: "pa$$word", want: "pa$$word"},
+		{name: "variable", in: "${IT_HOST}:${IT_PORT}", want: "db.local:3307"},
+		{name: "unset", in: "${IT_UNSET}", err: "env IT_UNSET is not set or empty"},
+		{name: "empty", in: "${IT_EMPTY}", err: "env IT_EMPTY is not set or empty"},
+		{name: "escaped", in: "$${IT_HOST}", want: "${IT_HOST}"},
+		{name: "escaped and variable", in: "$${IT_HOST} ${IT_HOST}", want: "${IT_HOST} db.local"},
+
+		{name: "colon default unset", in: "${IT_UNSET:-x}", want: "x"},
+		{name: "colon default empty", in: "${IT_EMPTY:-x}", want: "x"},
+		{name: "colon default set", in: "${IT_HOST:-x}", want: "db.local"},
+		{name: "default unset", in: "${IT_UNSET-x}", want: "x"},
+		{name: "default empty", in: "${IT_EMPTY-x}", want: ""},
+		{name: "empty default", in: "${IT_UNSET:-}", want: ""},
+		{name: "nested default", in: "${IT_UNSET:-${IT_HOST}}:${IT_UNSET:-3306}", want: "db.local:3306"},
+		{name: "nested twice", in: "${IT_UNSET:-${IT_EMPTY:-${IT_PORT}}}", want: "3307"},
+		{name: "nested error", in: "${IT_UNSET:-${IT_EMPTY}}", err: "env IT_EMPTY is not set or empty"},
+
+		{name: "colon required unset", in: "${IT_UNSET:?host is required}", err: "env IT_UNSET: host is required"},
+		{name: "colon required empty", in: "${IT_EMPTY:?host is required}", err: "env IT_EMPTY: host is required"},
+		{name: "required empty", in: "${IT_EMPTY?host is required}", want: ""},
+		{name: "required unset", in: "${IT_UNSET?}", err: "env IT_UNSET is not set"},
+		{name: "required set", in: "${IT_HOST:?}", want: "db.local"},
+
+		{name: "unclosed", in: "${IT_HOST", err: "unclosed ${"},
+		{name: "invalid name", in: "${1X}", err: "invalid variable name"},
+		{name: "invalid expression", in: "${IT_HOST+x}", err: "invalid expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolate(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("interpolate(%q) err = %v, want %q", tt.in, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolate(%q) err = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Fatalf("interpolate(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateSettings(t *testing.T) {
+	t.Setenv("IT_HOST", "db.local")
+	os.Unsetenv("IT_UNSET")
+
+	settings := map[string]interface{}{
+		"database": []interface{}{
+			map[string]interface{}{"host": "${IT_HOST}", "port": 3306},
+			map[string]interface{}{"host": "${IT_UNSET}"},
+		},
+		"global": map[string]interface{}{"namespace": "${IT_UNSET:?}"},
+	}
+	err := interpolateSettings(settings)
+	errs, ok := err.(ValidationError)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("interpolateSettings err = %v, want 2 field errors", err)
+	}
+	var keys = map[string]bool{}
+	for _, e := range errs {
+		keys[e.Key] = true
+	}
+	for _, k := range []string{"database[1].host", "global.namespace"} {
+		if !keys[k] {
+			t.Errorf("interpolateSettings err = %v, want an error for %s", err, k)
+		}
+	}
+	db := settings["database"].([]interface{})[0].(map[string]interface{})
+	if db["host"] != "db.local" || db["port"] != 3306 {
+		t.Errorf("database[0] = %v", db)
+	}
+}
@@ -0,0 +1,552 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// The config is merged from these layers, a later layer overrides the keys it sets in the earlier ones:
+//
+//  1. defaults     values set by SetDefault before Init
+//  2. base files   the -conf file, ./config/config.yaml by default, then the files of the conf.d directory
+//                  next to it, or of -conf_dir, in lexical order. The format is given by the extension,
+//                  .yaml, .yml, .json or .toml
+//  3. env file     config.<env>.yaml next to the -conf file, env is the -env flag or $<prefix>_ENV
+//  4. environment  variables <prefix>_<KEY>, prefix is the -env_prefix flag, APP by default. Levels of
+//                  the key are separated by _ for the keys of a lower layer or of Conf, other variables
+//                  such as APP_NAME are ignored, or by __ for any key, e.g. APP_SERVER_PORT and
+//                  APP_EXTEND__MAX_SIZE. List elements are addressed by index, e.g. APP_DATABASE_0_PASS.
+//                  <prefix>_ENV and <prefix>_CONFIG_KEY* are not keys
+//  5. flags        -set key=value, may be repeated, e.g. -set log.level=1
+//  6. remote       the sources of the remote section of the local layers, etcd prefixes and configmgr
+//                  keys, then the sources added by AddSource, in order
+//
+// Maps are merged key by key, lists and other values are replaced as a whole. Lookup and Origins tell
+// which layer an effective value came from.
+
+const (
+	defaultEnvPrefix = "APP"
+	originDefault    = "default"
+)
+
+type layer struct {
+	origin   string
+	settings map[string]interface{}
+	// keyOrigin is the origin of single keys when they differ from origin, e.g. the environment variable
+	keyOrigin map[string]string
+}
+
+// reservedEnv are the variables after the prefix that configure the loading instead of setting keys,
+// together with the CONFIG_KEY* variables of the secrets
+var reservedEnv = map[string]bool{
+	"ENV": true,
+}
+
+var (
+	confDir   string
+	envName   string
+	envPrefix = defaultEnvPrefix
+	setFlags  setFlag
+
+	defaultsMu sync.Mutex
+	defaults   = map[string]interface{}{}
+)
+
+// setFlag collects the -set flags
+type setFlag []string
+
+func (s *setFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("invalid -set %q, want key=value", v)
+	}
+	*s = append(*s, v)
+	return nil
+}
+
+// SetDefault sets the default value of a dotted key, e.g. "server.port", used when no other layer sets it
+func SetDefault(key string, value interface{}) {
+	defaultsMu.Lock()
+	setPath(defaults, key, value)
+	defaultsMu.Unlock()
+}
+
+func environment() string {
+	if envName != "" {
+		return envName
+	}
+	return os.Getenv(envPrefix + "_ENV")
+}
+
+// envFile returns the overlay of path for env, config/config.yaml -> config/config.<env>.yaml
+func envFile(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// formats maps the extensions of the config files to their format
+var formats = map[string]string{
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".json": "json",
+	".toml": "toml",
+}
+
+// readFile returns the settings of a config file, the format is given by the extension
+func readFile(path string) (map[string]interface{}, error) {
+	format, ok := formats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("read config file failed, config-file=[%s], err_msg=[unsupported format %q]", path, filepath.Ext(path))
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file failed, config-file=[%s], err_msg=[%s]", path, err.Error())
+	}
+	vp := viper.New()
+	vp.SetConfigType(format)
+	if err = vp.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("read config file failed, config-file=[%s], err_msg=[%s]", path, err.Error())
+	}
+	return vp.AllSettings(), nil
+}
+
+// configDir returns the conf.d directory, next to the config file unless -conf_dir is given
+func configDir() string {
+	if confDir != "" {
+		return confDir
+	}
+	return filepath.Join(filepath.Dir(confPath), "conf.d")
+}
+
+// dirFiles returns the config files of dir in lexical order, none when dir does not exist. Hidden
+// files and other extensions are skipped, such as the ..data directory of a kubernetes ConfigMap
+func dirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config dir failed, config-dir=[%s], err_msg=[%s]", dir, err.Error())
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if _, ok := formats[strings.ToLower(filepath.Ext(name))]; ok {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files, nil
+}
+
+// loadLayers reads the layers in order of precedence, lowest first
+func loadLayers() ([]layer, error) {
+	var layers []layer
+
+	defaultsMu.Lock()
+	layers = append(layers, layer{origin: originDefault, settings: copyMap(defaults)})
+	defaultsMu.Unlock()
+
+	base, err := readFile(confPath)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, layer{origin: "file:" + confPath, settings: base})
+
+	files, err := dirFiles(configDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if filepath.Clean(path) == filepath.Clean(confPath) {
+			continue
+		}
+		m, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer{origin: "file:" + path, settings: m})
+	}
+
+	if env := environment(); env != "" {
+		path := envFile(confPath, env)
+		if _, err = os.Stat(path); err == nil {
+			m, err := readFile(path)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, layer{origin: "file:" + path, settings: m})
+		}
+	}
+
+	env, err := envLayer(mergeLayers(layers))
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, env)
+
+	flags, err := flagLayer(mergeLayers(layers))
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, flags)
+
+	layers = append(layers, remoteLayers()...)
+	return layers, nil
+}
+
+// envLayer maps the environment variables with the prefix to the keys of lower, the merge of the lower
+// layers, or of Conf. The elements of a list are addressed by their index, e.g. APP_DATABASE_0_PASS is
+// the pass of the first database. The other variables are ignored unless they separate the levels by __
+func envLayer(lower map[string]interface{}) (layer, error) {
+	var l = layer{origin: "env", settings: map[string]interface{}{}, keyOrigin: map[string]string{}}
+
+	var known = map[string]string{}
+	var keys = map[string]interface{}{}
+	dumpFlatten("", lower, keys)
+	structKeys(reflect.TypeOf(Conf{}), "", keys)
+	for k := range keys {
+		k = indexKey(k)
+		known[strings.ReplaceAll(k, ".", "_")] = k
+	}
+
+	prefix := envPrefix + "_"
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, prefix) || reservedEnv[strings.TrimPrefix(name, prefix)] ||
+			strings.HasPrefix(name, prefix+"CONFIG_KEY") {
+			continue
+		}
+		rest := strings.ToLower(strings.TrimPrefix(name, prefix))
+		var key string
+		switch {
+		case strings.Contains(rest, "__"):
+			key = strings.ReplaceAll(rest, "__", ".")
+		case known[rest] != "":
+			key = known[rest]
+		case elementKey(known, rest) != "":
+			key = elementKey(known, rest)
+		default:
+			// not a key of the config, e.g. APP_NAME set for another program
+			continue
+		}
+		if err := checkPath(lower, key); err != nil {
+			return l, fmt.Errorf("invalid environment variable %s, %v", name, err)
+		}
+		setPath(l.settings, key, value)
+		l.keyOrigin[key] = "env:" + name
+	}
+	return l, nil
+}
+
+func flagLayer(lower map[string]interface{}) (layer, error) {
+	var l = layer{origin: "flag", settings: map[string]interface{}{}, keyOrigin: map[string]string{}}
+	for _, s := range setFlags {
+		key, value, _ := strings.Cut(s, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			return l, fmt.Errorf("invalid -set %q, key is empty", s)
+		}
+		if err := checkPath(lower, key); err != nil {
+			return l, fmt.Errorf("invalid -set %q, %v", s, err)
+		}
+		setPath(l.settings, key, value)
+		l.keyOrigin[key] = "flag:-set " + key
+	}
+	return l, nil
+}
+
+// elementKey returns the key of a field of a list element, database_1_max_open_conns matches
+// database.*.max_open_conns and is database.1.max_open_conns
+func elementKey(known map[string]string, rest string) string {
+	parts := strings.Split(rest, "_")
+	var indexes []string
+	for i, p := range parts {
+		if _, err := strconv.Atoi(p); err == nil {
+			indexes = append(indexes, p)
+			parts[i] = "*"
+		}
+	}
+	if len(indexes) == 0 {
+		return ""
+	}
+	key := known[strings.Join(parts, "_")]
+	if key == "" {
+		return ""
+	}
+	for _, i := range indexes {
+		key = strings.Replace(key, "*", i, 1)
+	}
+	return key
+}
+
+// indexKey converts the list indexes of dumpFlatten to key segments, database[0].pass -> database.0.pass
+func indexKey(k string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(k, "[", "."), "]", "")
+}
+
+// checkPath reports a key that goes through a value which is neither a map nor a list, or through a
+// list with a segment that is not the index of one of its elements
+func checkPath(lower map[string]interface{}, key string) error {
+	var v interface{} = lower
+	parts := strings.Split(strings.ToLower(key), ".")
+	for i, p := range parts {
+		switch cur := v.(type) {
+		case map[string]interface{}:
+			v = cur[p]
+		case []interface{}:
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 || n >= len(cur) {
+				return fmt.Errorf("%s is a list of %d elements, %s is not an index of it", strings.Join(parts[:i], "."), len(cur), p)
+			}
+			v = cur[n]
+		case nil:
+			return nil
+		default:
+			return fmt.Errorf("%s is a value, it has no key %s", strings.Join(parts[:i], "."), p)
+		}
+	}
+	return nil
+}
+
+// structKeys adds the keys of the fields of t, named by their mapstructure tag. The elements of a
+// list of structs are keyed by *, e.g. database.*.pass
+func structKeys(t reflect.Type, prefix string, keys map[string]interface{}) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		e := t.Elem()
+		for e.Kind() == reflect.Ptr {
+			e = e.Elem()
+		}
+		if e.Kind() == reflect.Struct {
+			structKeys(e, joinKey(prefix, "*"), keys)
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		if prefix != "" {
+			keys[prefix] = nil
+		}
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		structKeys(f.Type, joinKey(prefix, fieldKey(f)), keys)
+	}
+}
+
+func mergeLayers(layers []layer) map[string]interface{} {
+	var m = map[string]interface{}{}
+	for _, l := range layers {
+		merge(m, l.settings)
+	}
+	return m
+}
+
+// origins returns the origin of every leaf key of settings, the last layer setting a key wins
+func origins(layers []layer, settings map[string]interface{}) map[string]string {
+	var final = map[string]interface{}{}
+	flatten("", settings, final)
+
+	var out = make(map[string]string, len(final))
+	for _, l := range layers {
+		var keys = map[string]interface{}{}
+		flatten("", l.settings, keys)
+		for k := range keys {
+			if _, ok := final[k]; !ok {
+				continue
+			}
+			if o, ok := l.keyOrigin[k]; ok {
+				out[k] = o
+			} else {
+				out[k] = l.origin
+			}
+		}
+		// keys of list elements, kept as database[0].pass as Dump names them
+		for k, o := range l.keyOrigin {
+			if _, ok := final[k]; !ok {
+				if bk := listKey(k); bk != k {
+					out[bk] = o
+				}
+			}
+		}
+	}
+	return out
+}
+
+// listKey converts the index segments of a key to list indexes, database.0.pass -> database[0].pass
+func listKey(k string) string {
+	parts := strings.Split(k, ".")
+	var b strings.Builder
+	for i, p := range parts {
+		if _, err := strconv.Atoi(p); err == nil && i > 0 {
+			b.WriteString("[" + p + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteString(".")
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// Lookup returns the effective value of a dotted key and the layer it came from, e.g.
+// "file:./config/config.yaml" or "env:APP_SERVER_PORT". The origin of a section is "", see Origins
+func Lookup(key string) (interface{}, string, bool) {
+	s := current.Load()
+	if s == nil {
+		return nil, "", false
+	}
+	key = strings.ToLower(key)
+	v := section(s.settings, key)
+	if v == nil {
+		return nil, "", false
+	}
+	return v, s.origins[key], true
+}
+
+// Origins returns the origin of every effective key, sorted by key in the String of the result
+func Origins() KeyOrigins {
+	s := current.Load()
+	if s == nil {
+		return nil
+	}
+	var out = make(KeyOrigins, len(s.origins))
+	for k, v := range s.origins {
+		out[k] = v
+	}
+	return out
+}
+
+// KeyOrigins maps dotted keys to the layer their value came from
+type KeyOrigins map[string]string
+
+func (o KeyOrigins) String() string {
+	var keys = make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s = %s\n", k, o[k])
+	}
+	return b.String()
+}
+
+func setPath(m map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+}
+
+// merge copies src into dst, maps are merged key by key and other values replaced. A map whose keys
+// are all indexes of a list of dst, set by an environment variable or -set, is merged into the elements
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sm, ok := v.(map[string]interface{}); ok {
+			if dm, ok := dst[k].(map[string]interface{}); ok {
+				merge(dm, sm)
+				continue
+			}
+			if dl, ok := dst[k].([]interface{}); ok && isIndexMap(sm, len(dl)) {
+				dst[k] = mergeList(dl, sm)
+				continue
+			}
+			dst[k] = copyMap(sm)
+			continue
+		}
+		dst[k] = copyValue(v)
+	}
+}
+
+func isIndexMap(m map[string]interface{}, n int) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= n {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeList returns a copy of list with the elements of the index map merged in
+func mergeList(list []interface{}, m map[string]interface{}) []interface{} {
+	out := copyValue(list).([]interface{})
+	for k, v := range m {
+		i, _ := strconv.Atoi(k)
+		em, eok := out[i].(map[string]interface{})
+		vm, vok := v.(map[string]interface{})
+		if eok && vok {
+			merge(em, vm)
+			continue
+		}
+		out[i] = copyValue(v)
+	}
+	return out
+}
+
+// copyValue copies the maps and lists in v, so that the layers never share them
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return copyMap(v)
+	case []interface{}:
+		var out = make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = copyValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	var out = make(map[string]interface{}, len(m))
+	merge(out, m)
+	return out
+}
+
+// flatten adds the leaf values of m to out under their dotted keys
+func flatten(prefix string, m map[string]interface{}, out map[string]interface{}) {
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if sm, ok := v.(map[string]interface{}); ok && len(sm) > 0 {
+			flatten(k, sm, out)
+			continue
+		}
+		out[k] = v
+	}
+}
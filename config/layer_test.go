@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvLayer(t *testing.T) {
+	lower := map[string]interface{}{
+		"database": []interface{}{map[string]interface{}{"name": "order", "pass": "x"}},
+		"extend":   map[string]interface{}{"limit": 1},
+	}
+	tests := []struct {
+		env string
+		// key is the key set by env, "" when env is not a key
+		key string
+		err string
+	}{
+		{env: "APP_SERVER_PORT", key: "server.port"},
+		{env: "APP_EXTEND_LIMIT", key: "extend.limit"},
+		{env: "APP_EXTEND__MAX_SIZE", key: "extend.max_size"},
+		{env: "APP_DATABASE_0_PASS", key: "database.0.pass"},
+		{env: "APP_DATABASE_0_MAX_OPEN_CONNS", key: "database.0.max_open_conns"},
+		{env: "APP_NAME"},
+		{env: "APP_EXTEND_OTHER"},
+		{env: "APP_ENV"},
+		{env: "APP_CONFIG_KEY"},
+		{env: "APP_CONFIG_KEY_FILE"},
+		{env: "APP_CONFIG_KEY_OLD"},
+		{env: "OTHER_SERVER_PORT"},
+		{env: "APP_DATABASE_1_PASS", err: "database is a list of 1 elements, 1 is not an index of it"},
+		{env: "APP_EXTEND__LIMIT__MAX", err: "extend.limit is a value, it has no key max"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(tt.env, "1")
+			l, err := envLayer(lower)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("envLayer err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("envLayer err = %v", err)
+			}
+			var want = map[string]string{}
+			if tt.key != "" {
+				want[tt.key] = "env:" + tt.env
+			}
+			if !reflect.DeepEqual(l.keyOrigin, want) {
+				t.Fatalf("envLayer keys = %v, want %v", l.keyOrigin, want)
+			}
+		})
+	}
+}
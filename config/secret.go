@@ -0,0 +1,172 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Values written as ENC(<base64>) are encrypted with AES-256-GCM and decrypted when the config is
+// loaded. The key is 32 bytes in base64, read from the -conf_key_file flag, the file named by
+// $<prefix>_CONFIG_KEY_FILE or $<prefix>_CONFIG_KEY, in that order. basectl keygen creates a key and
+// basectl encrypt encrypts a value.
+
+const (
+	encPrefix = "ENC("
+	encSuffix = ")"
+	keySize   = 32
+)
+
+var keyFile string
+
+// ErrNoKey is returned when the config has encrypted values and no key is configured
+var ErrNoKey = errors.New("config key is not set")
+
+// IsEncrypted reports whether v is an ENC(...) value
+func IsEncrypted(v string) bool {
+	return strings.HasPrefix(v, encPrefix) && strings.HasSuffix(v, encSuffix)
+}
+
+// GenerateKey returns a new random key in base64
+func GenerateKey() (string, error) {
+	var key = make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 key
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode config key failed, err = %v", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("config key is %d bytes, want %d", len(key), keySize)
+	}
+	return key, nil
+}
+
+// LoadKey returns the configured key, or ErrNoKey
+func LoadKey() ([]byte, error) {
+	path := keyFile
+	if path == "" {
+		path = os.Getenv(envPrefix + "_CONFIG_KEY_FILE")
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config key file failed, file=[%s], err = %v", path, err)
+		}
+		return ParseKey(string(data))
+	}
+	if s := os.Getenv(envPrefix + "_CONFIG_KEY"); s != "" {
+		return ParseKey(s)
+	}
+	return nil, ErrNoKey
+}
+
+// EncryptValue encrypts plaintext to an ENC(...) value
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	var nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed) + encSuffix, nil
+}
+
+// DecryptValue decrypts an ENC(...) value
+func DecryptValue(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", fmt.Errorf("value is not ENC(...)")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, encPrefix), encSuffix))
+	if err != nil {
+		return "", fmt.Errorf("decode value failed, err = %v", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("value is too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt value failed, wrong key or corrupted value")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("config key is %d bytes, want %d", len(key), keySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptSettings replaces the ENC(...) values of settings and returns their keys. The key is only
+// loaded when there is an encrypted value
+func decryptSettings(settings map[string]interface{}) (map[string]bool, error) {
+	var (
+		key     []byte
+		keyErr  error
+		loaded  bool
+		secrets = map[string]bool{}
+		errs    ValidationError
+	)
+	var walk func(v interface{}, path string) interface{}
+	walk = func(v interface{}, path string) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				v[k] = walk(e, joinKey(path, k))
+			}
+		case []interface{}:
+			for i, e := range v {
+				v[i] = walk(e, fmt.Sprintf("%s[%d]", path, i))
+			}
+		case string:
+			if !IsEncrypted(v) {
+				return v
+			}
+			if !loaded {
+				key, keyErr = LoadKey()
+				loaded = true
+			}
+			if keyErr != nil {
+				errs = append(errs, FieldError{Key: path, Message: keyErr.Error()})
+				return v
+			}
+			plain, err := DecryptValue(key, v)
+			if err != nil {
+				errs = append(errs, FieldError{Key: path, Message: err.Error()})
+				return v
+			}
+			secrets[path] = true
+			return plain
+		}
+		return v
+	}
+	walk(settings, "")
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return secrets, nil
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liuyp5181/base/etcd"
+	"github.com/liuyp5181/base/log"
+	"github.com/liuyp5181/base/signal"
+	"github.com/spf13/viper"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// SourceTimeout bounds a Load of a remote source
+	SourceTimeout = 5 * time.Second
+	// SourceRetryInterval is the wait of a Watcher before it reconnects
+	SourceRetryInterval = time.Second
+)
+
+// Remote is a remote source of the config, listed in the remote section of the local layers:
+//
+//	remote:
+//	  - type: etcd
+//	    prefix: config/order/   # each key under the prefix is a section, config/order/log is log,
+//	                            # the key equal to the prefix is a whole document
+//	    cache: ./config/cache/etcd.json
+//	  - type: configmgr         # registered by the client/configmgr package, which must be imported
+//	    group: order
+//	    key: base
+//	    format: yaml
+type Remote struct {
+	Type   string `mapstructure:"type" validate:"required"`
+	Prefix string `mapstructure:"prefix"`
+	Group  string `mapstructure:"group"`
+	Key    string `mapstructure:"key"`
+	Format string `mapstructure:"format" default:"yaml" validate:"oneof=yaml json toml"`
+	// Cache is the file keeping the last settings of the source, used when it is unreachable at startup
+	Cache string `mapstructure:"cache"`
+	// Optional lets Init go on without the source when it is unreachable and has no cache
+	Optional bool `mapstructure:"optional"`
+}
+
+// Source is a remote layer of the config. Sources are loaded once etcd is initialized, after the local
+// layers, so a source can not change the etcd config
+type Source interface {
+	// Name is the origin reported by Lookup, e.g. configmgr:group/key
+	Name() string
+	// Load returns the settings of the source, nested maps keyed by lower case names
+	Load() (map[string]interface{}, error)
+}
+
+// Watcher is a Source reporting its changes, the config is then reloaded as for a change of the file
+type Watcher interface {
+	Source
+	// Watch calls update with the settings of the source when it changes, until ctx is done. It may
+	// call update with unchanged settings, e.g. after a reconnection
+	Watch(ctx context.Context, update func(settings map[string]interface{}))
+}
+
+// SourceFactory creates the Source of an entry of the remote section
+type SourceFactory func(r Remote) (Source, error)
+
+type remoteSource struct {
+	src      Source
+	cache    string
+	optional bool
+
+	sync.Mutex
+	origin   string
+	settings map[string]interface{}
+}
+
+var (
+	sourceMu  sync.Mutex
+	factories = map[string]SourceFactory{"etcd": newEtcdSource}
+	added     []Source
+	sources   []*remoteSource
+)
+
+// RegisterSource registers the factory of a type of the remote section
+func RegisterSource(typ string, f SourceFactory) {
+	sourceMu.Lock()
+	factories[typ] = f
+	sourceMu.Unlock()
+}
+
+// AddSource adds a remote layer above the ones of the remote section, it must be called before Init.
+// Init goes on without it when it can not be loaded
+func AddSource(s Source) {
+	sourceMu.Lock()
+	added = append(added, s)
+	sourceMu.Unlock()
+}
+
+// initSources loads the remote sources and starts watching the ones that report their changes
+func initSources(list []Remote, watch bool) error {
+	sourceMu.Lock()
+	var rs []*remoteSource
+	for _, r := range list {
+		f := factories[r.Type]
+		if f == nil {
+			sourceMu.Unlock()
+			return fmt.Errorf("unknown remote config type %q, is its package imported", r.Type)
+		}
+		src, err := f(r)
+		if err != nil {
+			sourceMu.Unlock()
+			return fmt.Errorf("create remote config %q failed, err = %v", r.Type, err)
+		}
+		rs = append(rs, &remoteSource{src: src, cache: r.Cache, optional: r.Optional})
+	}
+	for _, s := range added {
+		rs = append(rs, &remoteSource{src: s, optional: true})
+	}
+	sourceMu.Unlock()
+
+	for _, r := range rs {
+		if err := r.load(); err != nil {
+			return err
+		}
+	}
+
+	sourceMu.Lock()
+	sources = rs
+	sourceMu.Unlock()
+
+	if !watch {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signal.RegisterClose(cancel)
+	for _, r := range rs {
+		if w, ok := r.src.(Watcher); ok {
+			go w.Watch(ctx, r.update)
+		}
+	}
+	return nil
+}
+
+// remoteLayers returns the layers of the loaded sources
+func remoteLayers() []layer {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	var list = make([]layer, 0, len(sources))
+	for _, r := range sources {
+		r.Lock()
+		if r.settings != nil {
+			list = append(list, layer{origin: r.origin, settings: copyMap(r.settings)})
+		}
+		r.Unlock()
+	}
+	return list
+}
+
+func (r *remoteSource) set(settings map[string]interface{}, origin string) {
+	r.Lock()
+	r.settings = settings
+	r.origin = origin
+	r.Unlock()
+}
+
+// load loads the source, or its cache when it is unreachable
+func (r *remoteSource) load() error {
+	m, err := r.src.Load()
+	if err == nil {
+		r.set(m, r.src.Name())
+		r.writeCache(m)
+		return nil
+	}
+	if r.cache != "" {
+		if cm, cerr := readCache(r.cache); cerr == nil {
+			log.Warningf("load config source [%s] failed, use the cache %s, err = %v", r.src.Name(), r.cache, err)
+			r.set(cm, r.src.Name()+" (cache)")
+			return nil
+		}
+	}
+	if r.optional {
+		log.Errorf("load config source [%s] failed, err = %v", r.src.Name(), err)
+		return nil
+	}
+	return fmt.Errorf("load config source [%s] failed, err = %v", r.src.Name(), err)
+}
+
+func (r *remoteSource) update(settings map[string]interface{}) {
+	r.set(settings, r.src.Name())
+	r.writeCache(settings)
+	if err := reload(); err != nil {
+		log.Errorf("reload config failed, keep the current config, err = %v", err)
+	}
+}
+
+// writeCache saves the settings, still encrypted when they were, to the cache file
+func (r *remoteSource) writeCache(settings map[string]interface{}) {
+	if r.cache == "" {
+		return
+	}
+	data, err := json.Marshal(settings)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(r.cache), 0755)
+	}
+	if err == nil {
+		tmp := r.cache + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, r.cache)
+		}
+	}
+	if err != nil {
+		log.Errorf("write config cache %s failed, err = %v", r.cache, err)
+	}
+}
+
+func readCache(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseValue returns the settings of a document in format, or the value as a string when it is not a
+// document, e.g. a single number
+func ParseValue(data []byte, format string) interface{} {
+	vp := viper.New()
+	vp.SetConfigType(format)
+	if err := vp.ReadConfig(bytes.NewReader(data)); err != nil {
+		return string(data)
+	}
+	return vp.AllSettings()
+}
+
+type etcdSource struct {
+	prefix string
+	format string
+}
+
+func newEtcdSource(r Remote) (Source, error) {
+	if r.Prefix == "" {
+		return nil, fmt.Errorf("prefix of the etcd source is empty")
+	}
+	return &etcdSource{prefix: r.Prefix, format: r.Format}, nil
+}
+
+func (s *etcdSource) Name() string {
+	return "etcd:" + s.prefix
+}
+
+func (s *etcdSource) Load() (map[string]interface{}, error) {
+	m, _, err := s.get(context.Background())
+	return m, err
+}
+
+func (s *etcdSource) get(ctx context.Context) (map[string]interface{}, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, SourceTimeout)
+	defer cancel()
+	resp, err := etcd.GetClient().Get(ctx, s.prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.settings(resp.Kvs), resp.Header.Revision, nil
+}
+
+// settings merges the keys in order, the key equal to the prefix sorts first
+func (s *etcdSource) settings(kvs []*mvccpb.KeyValue) map[string]interface{} {
+	var m = map[string]interface{}{}
+	for _, kv := range kvs {
+		v := ParseValue(kv.Value, s.format)
+		rest := strings.Trim(strings.TrimPrefix(string(kv.Key), s.prefix), "/")
+		if rest == "" {
+			if vm, ok := v.(map[string]interface{}); ok {
+				merge(m, vm)
+			} else {
+				log.Warningf("config source [%s] skip key %s, not a document", s.Name(), kv.Key)
+			}
+			continue
+		}
+		var section = map[string]interface{}{}
+		setPath(section, strings.ReplaceAll(rest, "/", "."), v)
+		merge(m, section)
+	}
+	return m
+}
+
+// Watch reads the whole prefix again after every change, and after a reconnection
+func (s *etcdSource) Watch(ctx context.Context, update func(settings map[string]interface{})) {
+	for ctx.Err() == nil {
+		m, rev, err := s.get(ctx)
+		if err != nil {
+			log.Errorf("config source [%s] get failed, err = %v", s.Name(), err)
+		} else {
+			update(m)
+			s.watch(ctx, rev, update)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(SourceRetryInterval):
+		}
+	}
+}
+
+func (s *etcdSource) watch(ctx context.Context, rev int64, update func(settings map[string]interface{})) {
+	wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	wc := etcd.GetClient().Watch(wctx, s.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	for resp := range wc {
+		if err := resp.Err(); err != nil {
+			log.Errorf("config source [%s] watch failed, err = %v", s.Name(), err)
+			return
+		}
+		if len(resp.Events) == 0 {
+			continue
+		}
+		m, _, err := s.get(ctx)
+		if err != nil {
+			log.Errorf("config source [%s] get failed, err = %v", s.Name(), err)
+			return
+		}
+		update(m)
+	}
+}
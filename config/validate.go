@@ -0,0 +1,303 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Fields of Conf and of the structs given to Load may carry two tags:
+//
+//	default:"3306"                 the value used when the key is not set by any layer
+//	validate:"required,min=1,max=65535"
+//
+// The rules of validate are separated by commas:
+//
+//	required       the value is not zero
+//	min=n, max=n   bounds of a number, of a duration (min=1s) or of the length of a string, list or map
+//	oneof=a b c    the value is one of the words
+//	url            a string with a scheme and a host
+//	duration       a string parsed by time.ParseDuration
+//
+// The rules other than required are not checked on zero values. Defaults of an optional section, a
+// pointer to a struct, are only used when the section is set.
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// FieldError is an invalid key of the config
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+// ValidationError lists every invalid key of the config
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid config:")
+	for _, f := range e {
+		b.WriteString("\n\t")
+		if f.Key != "" {
+			b.WriteString(f.Key)
+			b.WriteString(": ")
+		}
+		b.WriteString(f.Message)
+	}
+	return b.String()
+}
+
+// Validate checks the validate tags of the struct pointed to by v and returns a ValidationError
+// listing all the invalid fields
+func Validate(v interface{}) error {
+	return decodeAndValidate(nil, v, "")
+}
+
+// decodeAndValidate decodes settings into out unless settings is nil, then validates out. The keys
+// that can not be decoded are reported together with the invalid ones
+func decodeAndValidate(settings map[string]interface{}, out interface{}, prefix string) error {
+	var errs ValidationError
+	if settings != nil {
+		err := decode(settings, out, prefix)
+		if ve, ok := err.(ValidationError); ok {
+			errs = append(errs, ve...)
+		} else if err != nil {
+			return err
+		}
+	}
+	validateValue(reflect.ValueOf(out), prefix, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// decode converts settings to out with the hooks of the config and reports every key that can not be converted
+func decode(settings map[string]interface{}, out interface{}, prefix string) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       decodeHook,
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+	err = dec.Decode(settings)
+	if me, ok := err.(*mapstructure.Error); ok {
+		var errs ValidationError
+		for _, msg := range me.Errors {
+			errs = append(errs, FieldError{Key: errorKey(msg, prefix), Message: msg})
+		}
+		return errs
+	}
+	return err
+}
+
+// errorKey returns the quoted key of a mapstructure error message
+func errorKey(msg, prefix string) string {
+	i := strings.IndexByte(msg, '\'')
+	if i < 0 {
+		return prefix
+	}
+	j := strings.IndexByte(msg[i+1:], '\'')
+	if j < 0 {
+		return prefix
+	}
+	return joinKey(prefix, strings.ToLower(msg[i+1:i+1+j]))
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if key == "" {
+		return prefix
+	}
+	return prefix + "." + key
+}
+
+func fieldKey(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// fillDefaults sets the default tags of t in m for the keys that are not set, origins records them
+func fillDefaults(t reflect.Type, m map[string]interface{}, prefix string, origins map[string]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := fieldKey(f)
+		key := joinKey(prefix, name)
+		if def, ok := f.Tag.Lookup("default"); ok {
+			if _, exist := m[name]; !exist {
+				m[name] = def
+				if origins != nil {
+					origins[key] = originDefault
+				}
+			}
+			continue
+		}
+
+		ft := f.Type
+		switch {
+		case ft.Kind() == reflect.Struct:
+			sub, ok := m[name].(map[string]interface{})
+			if !ok {
+				if _, exist := m[name]; exist {
+					continue
+				}
+				sub = map[string]interface{}{}
+			}
+			fillDefaults(ft, sub, key, origins)
+			if len(sub) > 0 {
+				m[name] = sub
+			}
+		case ft.Kind() == reflect.Ptr:
+			if sub, ok := m[name].(map[string]interface{}); ok {
+				fillDefaults(ft, sub, key, origins)
+			}
+		case ft.Kind() == reflect.Slice:
+			list, _ := m[name].([]interface{})
+			for j, e := range list {
+				if sub, ok := e.(map[string]interface{}); ok {
+					fillDefaults(ft.Elem(), sub, fmt.Sprintf("%s[%d]", key, j), origins)
+				}
+			}
+		}
+	}
+}
+
+func validateValue(v reflect.Value, key string, errs *ValidationError) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			fkey := joinKey(key, fieldKey(f))
+			fv := v.Field(i)
+			if rules := f.Tag.Get("validate"); rules != "" {
+				for _, rule := range strings.Split(rules, ",") {
+					if msg := checkRule(fv, strings.TrimSpace(rule)); msg != "" {
+						*errs = append(*errs, FieldError{Key: fkey, Message: msg})
+					}
+				}
+			}
+			validateValue(fv, fkey, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", key, i), errs)
+		}
+	}
+}
+
+// checkRule returns why v breaks the rule, or "" when it does not
+func checkRule(v reflect.Value, rule string) string {
+	name, param, _ := strings.Cut(rule, "=")
+	if name == "required" {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+	if v.IsZero() {
+		return ""
+	}
+
+	switch name {
+	case "min", "max":
+		return checkBound(v, name, param)
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, w := range strings.Fields(param) {
+			if s == w {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s], got %q", param, s)
+	case "url":
+		if v.Kind() != reflect.String {
+			return "url rule on a non string field"
+		}
+		u, err := url.Parse(v.String())
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Sprintf("must be a URL, got %q", v.String())
+		}
+	case "duration":
+		if v.Kind() != reflect.String {
+			return "duration rule on a non string field"
+		}
+		if _, err := time.ParseDuration(v.String()); err != nil {
+			return fmt.Sprintf("must be a duration, got %q", v.String())
+		}
+	default:
+		return fmt.Sprintf("unknown rule %q", rule)
+	}
+	return ""
+}
+
+func checkBound(v reflect.Value, name, param string) string {
+	var n, bound float64
+	var err error
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		d, err = time.ParseDuration(param)
+		n, bound = float64(v.Int()), float64(d)
+	case v.CanInt():
+		n = float64(v.Int())
+		bound, err = strconv.ParseFloat(param, 64)
+	case v.CanUint():
+		n = float64(v.Uint())
+		bound, err = strconv.ParseFloat(param, 64)
+	case v.CanFloat():
+		n = v.Float()
+		bound, err = strconv.ParseFloat(param, 64)
+	case v.Kind() == reflect.String, v.Kind() == reflect.Slice, v.Kind() == reflect.Map:
+		n = float64(v.Len())
+		bound, err = strconv.ParseFloat(param, 64)
+		if err == nil && name == "min" && n < bound {
+			return fmt.Sprintf("length must be >= %s, got %d", param, v.Len())
+		}
+		if err == nil && name == "max" && n > bound {
+			return fmt.Sprintf("length must be <= %s, got %d", param, v.Len())
+		}
+	default:
+		return fmt.Sprintf("%s rule on a %s field", name, v.Kind())
+	}
+	if err != nil {
+		return fmt.Sprintf("invalid %s=%s", name, param)
+	}
+	if name == "min" && n < bound {
+		return fmt.Sprintf("must be >= %s, got %v", param, v.Interface())
+	}
+	if name == "max" && n > bound {
+		return fmt.Sprintf("must be <= %s, got %v", param, v.Interface())
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type validateConf struct {
+	Name     string            `mapstructure:"name" validate:"required,min=2,max=8"`
+	Port     int               `mapstructure:"port" default:"8080" validate:"min=1,max=65535"`
+	Ratio    float64           `mapstructure:"ratio" validate:"max=1"`
+	Timeout  time.Duration     `mapstructure:"timeout" default:"5s" validate:"min=1s,max=1m"`
+	Policy   string            `mapstructure:"policy" default:"random" validate:"oneof=random round_robin"`
+	Endpoint string            `mapstructure:"endpoint" validate:"url"`
+	Interval string            `mapstructure:"interval" validate:"duration"`
+	Tags     []string          `mapstructure:"tags" validate:"max=2"`
+	Labels   map[string]string `mapstructure:"labels" validate:"min=1"`
+	Items    []validateItem    `mapstructure:"items"`
+	Optional *validateItem     `mapstructure:"optional"`
+}
+
+type validateItem struct {
+	ID   int    `mapstructure:"id" validate:"required"`
+	Kind string `mapstructure:"kind" default:"a" validate:"oneof=a b"`
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() validateConf {
+		return validateConf{Name: "order", Port: 80, Timeout: time.Second, Policy: "random"}
+	}
+	tests := []struct {
+		name string
+		edit func(c *validateConf)
+		// errs are the keys and a part of the message of the expected errors
+		errs map[string]string
+	}{
+		{name: "valid", edit: func(c *validateConf) {}},
+		{name: "required", edit: func(c *validateConf) { c.Name = "" }, errs: map[string]string{"name": "is required"}},
+		{name: "min length", edit: func(c *validateConf) { c.Name = "a" }, errs: map[string]string{"name": "length must be >= 2"}},
+		{name: "max length", edit: func(c *validateConf) { c.Name = "a long name" }, errs: map[string]string{"name": "length must be <= 8"}},
+		{name: "zero skips min", edit: func(c *validateConf) { c.Port = 0 }},
+		{name: "max int", edit: func(c *validateConf) { c.Port = 70000 }, errs: map[string]string{"port": "must be <= 65535"}},
+		{name: "min int", edit: func(c *validateConf) { c.Port = -1 }, errs: map[string]string{"port": "must be >= 1"}},
+		{name: "max float", edit: func(c *validateConf) { c.Ratio = 1.5 }, errs: map[string]string{"ratio": "must be <= 1"}},
+		{name: "min duration", edit: func(c *validateConf) { c.Timeout = time.Millisecond }, errs: map[string]string{"timeout": "must be >= 1s"}},
+		{name: "max duration", edit: func(c *validateConf) { c.Timeout = time.Hour }, errs: map[string]string{"timeout": "must be <= 1m"}},
+		{name: "oneof", edit: func(c *validateConf) { c.Policy = "first" }, errs: map[string]string{"policy": `got "first"`}},
+		{name: "url", edit: func(c *validateConf) { c.Endpoint = "http://localhost:8500" }},
+		{name: "url without host", edit: func(c *validateConf) { c.Endpoint = "localhost" }, errs: map[string]string{"endpoint": "must be a URL"}},
+		{name: "duration", edit: func(c *validateConf) { c.Interval = "1m30s" }},
+		{name: "invalid duration", edit: func(c *validateConf) { c.Interval = "often" }, errs: map[string]string{"interval": "must be a duration"}},
+		{name: "max list", edit: func(c *validateConf) { c.Tags = []string{"a", "b", "c"} }, errs: map[string]string{"tags": "length must be <= 2"}},
+		{name: "nil map skips min", edit: func(c *validateConf) { c.Labels = nil }},
+		{name: "min map", edit: func(c *validateConf) { c.Labels = map[string]string{} }, errs: map[string]string{"labels": "length must be >= 1"}},
+		{name: "list element", edit: func(c *validateConf) { c.Items = []validateItem{{ID: 1, Kind: "a"}, {Kind: "c"}} },
+			errs: map[string]string{"items[1].id": "is required", "items[1].kind": "must be one of"}},
+		{name: "nil pointer", edit: func(c *validateConf) { c.Optional = nil }},
+		{name: "pointer", edit: func(c *validateConf) { c.Optional = &validateItem{} }, errs: map[string]string{"optional.id": "is required"}},
+		{name: "all errors", edit: func(c *validateConf) { c.Name, c.Port = "", 70000 },
+			errs: map[string]string{"name": "is required", "port": "must be <= 65535"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.edit(&c)
+			checkErrors(t, Validate(&c), tt.errs)
+		})
+	}
+}
+
+func checkErrors(t *testing.T, err error, want map[string]string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+		return
+	}
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("err = %v, want a ValidationError", err)
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("err = %v, want %d errors", err, len(want))
+	}
+	for _, e := range errs {
+		msg, ok := want[e.Key]
+		if !ok || !strings.Contains(e.Message, msg) {
+			t.Errorf("%s: %s, want %q", e.Key, e.Message, msg)
+		}
+	}
+}
+
+func TestCheckRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		rule  string
+		want  string
+	}{
+		{name: "unknown rule", value: 1, rule: "positive", want: `unknown rule "positive"`},
+		{name: "invalid bound", value: 1, rule: "min=one", want: "invalid min=one"},
+		{name: "invalid duration bound", value: time.Second, rule: "min=1", want: "invalid min=1"},
+		{name: "bound on bool", value: true, rule: "max=1", want: "max rule on a bool field"},
+		{name: "url on int", value: 1, rule: "url", want: "url rule on a non string field"},
+		{name: "uint", value: uint(3), rule: "max=2", want: "must be <= 2, got 3"},
+		{name: "oneof int", value: 2, rule: "oneof=1 2 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkRule(reflect.ValueOf(tt.value), tt.rule); got != tt.want {
+				t.Fatalf("checkRule(%v, %s) = %q, want %q", tt.value, tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAndValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		want     validateConf
+		errs     map[string]string
+	}{
+		{
+			name:     "defaults",
+			settings: map[string]interface{}{"name": "order"},
+			want:     validateConf{Name: "order", Port: 8080, Timeout: 5 * time.Second, Policy: "random"},
+		},
+		{
+			name: "set values are kept",
+			settings: map[string]interface{}{"name": "order", "port": "9090", "timeout": "10s",
+				"items": []interface{}{map[string]interface{}{"id": 1}}},
+			want: validateConf{Name: "order", Port: 9090, Timeout: 10 * time.Second, Policy: "random",
+				Items: []validateItem{{ID: 1, Kind: "a"}}},
+		},
+		{
+			name:     "optional section",
+			settings: map[string]interface{}{"name": "order", "optional": map[string]interface{}{"id": 2}},
+			want: validateConf{Name: "order", Port: 8080, Timeout: 5 * time.Second, Policy: "random",
+				Optional: &validateItem{ID: 2, Kind: "a"}},
+		},
+		{
+			name:     "decode and validate errors",
+			settings: map[string]interface{}{"port": "http", "timeout": "1h"},
+			errs:     map[string]string{"port": "port", "name": "is required", "timeout": "must be <= 1m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fillDefaults(reflect.TypeOf(validateConf{}), tt.settings, "", nil)
+			var c validateConf
+			err := decodeAndValidate(tt.settings, &c, "")
+			checkErrors(t, err, tt.errs)
+			if len(tt.errs) == 0 && !reflect.DeepEqual(c, tt.want) {
+				t.Fatalf("decoded %+v, want %+v", c, tt.want)
+			}
+		})
+	}
+}
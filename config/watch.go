@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/liuyp5181/base/log"
+	"github.com/liuyp5181/base/signal"
+)
+
+// reloadDelay merges the events of one save, editors and kubernetes write a file in several steps
+const reloadDelay = 200 * time.Millisecond
+
+type subscriber struct {
+	section string
+	fn      func(old, new Conf)
+}
+
+var (
+	subMu       sync.Mutex
+	subscribers []subscriber
+)
+
+// OnChange calls fn after a reload changed the given section of the config file, e.g. "log" or
+// "server.port", or after any change when section is "". fn is called in the watcher goroutine
+func OnChange(section string, fn func(old, new Conf)) {
+	subMu.Lock()
+	subscribers = append(subscribers, subscriber{section: strings.ToLower(section), fn: fn})
+	subMu.Unlock()
+}
+
+func init() {
+	// 日志级别支持热更新，其他日志配置需要重启
+	OnChange("log", func(old, new Conf) {
+		if new.Log != nil {
+			log.SetLevel(new.Log.Level)
+		}
+	})
+}
+
+// startWatch watches the directories of the config files, so that files replaced by a rename or by a
+// kubernetes ConfigMap symlink swap are seen as well
+func startWatch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(confPath)
+	if err = w.Add(dir); err != nil {
+		w.Close()
+		return err
+	}
+	// the conf.d directory is watched once it exists, its parent tells when it is created
+	cd := filepath.Clean(configDir())
+	if parent := filepath.Dir(cd); parent != filepath.Clean(dir) {
+		if fi, err := os.Stat(parent); err == nil && fi.IsDir() {
+			if err = w.Add(parent); err != nil {
+				w.Close()
+				return err
+			}
+		}
+	}
+	if fi, err := os.Stat(cd); err == nil && fi.IsDir() {
+		if err = w.Add(cd); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	signal.RegisterClose(func() {
+		w.Close()
+	})
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op == fsnotify.Chmod {
+					continue
+				}
+				if ev.Op&fsnotify.Create != 0 && filepath.Clean(ev.Name) == cd {
+					if err := w.Add(cd); err != nil {
+						log.Errorf("watch config dir %s failed, err = %v", cd, err)
+					}
+				}
+				if timer == nil {
+					timer = time.AfterFunc(reloadDelay, func() {
+						if err := reload(); err != nil {
+							log.Errorf("reload config failed, keep the current config, err = %v", err)
+						}
+					})
+				} else {
+					timer.Reset(reloadDelay)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("watch config file failed, err = %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+type change struct {
+	old, new *snapshot
+}
+
+var (
+	reloadMu sync.Mutex
+
+	notifyMu  sync.Mutex
+	changes   []change
+	notifying bool
+)
+
+// reload merges the layers again and swaps the result in, the current config is kept when the new
+// one is invalid
+func reload() error {
+	reloadMu.Lock()
+	s, err := parse()
+	if err != nil {
+		reloadMu.Unlock()
+		return err
+	}
+	old := current.Load()
+	if old != nil && reflect.DeepEqual(old.settings, s.settings) {
+		reloadMu.Unlock()
+		return nil
+	}
+	current.Store(s)
+	log.Info("config reloaded")
+	if old != nil {
+		notifyMu.Lock()
+		changes = append(changes, change{old: old, new: s})
+		notifyMu.Unlock()
+	}
+	reloadMu.Unlock()
+
+	notify()
+	return nil
+}
+
+// notify runs the callbacks of the queued changes in order, without holding reloadMu so that a
+// callback may call Reload. The changes queued by such a callback are run after it returns
+func notify() {
+	notifyMu.Lock()
+	if notifying {
+		notifyMu.Unlock()
+		return
+	}
+	notifying = true
+	for len(changes) > 0 {
+		c := changes[0]
+		changes = changes[1:]
+		notifyMu.Unlock()
+		runCallbacks(c.old, c.new)
+		notifyMu.Lock()
+	}
+	notifying = false
+	notifyMu.Unlock()
+}
+
+func runCallbacks(old, new *snapshot) {
+	subMu.Lock()
+	list := append([]subscriber(nil), subscribers...)
+	subMu.Unlock()
+
+	for _, sub := range list {
+		if reflect.DeepEqual(section(old.settings, sub.section), section(new.settings, sub.section)) {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("config change callback of [%s] panic, err = %v", sub.section, r)
+				}
+			}()
+			sub.fn(old.conf, new.conf)
+		}()
+	}
+}
+
+// section returns the value at the dotted path in the settings, or all of them when path is ""
+func section(settings map[string]interface{}, path string) interface{} {
+	var v interface{} = settings
+	if path == "" {
+		return v
+	}
+	for _, k := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// Reload reads the config file again as the watcher does when the file changes, the current config
+// is kept when it returns an error
+func Reload() error {
+	if current.Load() == nil {
+		return fmt.Errorf("config is not initialized")
+	}
+	return reload()
+}
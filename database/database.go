@@ -1,12 +1,18 @@
 package database
 
 import (
-	"fmt"
 	"github.com/liuyp5181/base/config"
 )
 
 type Option func(*config.Database)
 
+// WithType sets the type of the database, e.g. sqlite to run the tests without a mysql server
+func WithType(typ string) Option {
+	return func(o *config.Database) {
+		o.Type = typ
+	}
+}
+
 func WithHost(Host string) Option {
 	return func(o *config.Database) {
 		o.Host = Host
@@ -37,16 +43,28 @@ func WithDB(db string) Option {
 	}
 }
 
+// WithParam adds a parameter to the DSN
+func WithParam(key, value string) Option {
+	return func(o *config.Database) {
+		params := make(map[string]string, len(o.Params)+1)
+		for k, v := range o.Params {
+			params[k] = v
+		}
+		params[key] = value
+		o.Params = params
+	}
+}
+
 func connect(conf config.Database) error {
-	switch conf.Type {
-	case "mysql":
-		return ConnectMysql(conf)
+	drv, err := getDriver(conf.Type)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("not found type = %v", conf.Type)
+	return open(conf, drv)
 }
 
 func Connect(name string, opts ...Option) error {
-	list := config.GetConfig().Database
+	list := config.Get().Database
 	for _, v := range list {
 		if v.Name == name {
 			for _, o := range opts {
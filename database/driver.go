@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/liuyp5181/base/config"
+	"github.com/liuyp5181/base/tracing"
+	"gorm.io/gorm"
+)
+
+// Driver returns the gorm dialector of a database entry, it is called for the primary and for every
+// replica, the fields of a replica replacing the ones of the primary
+type Driver func(cfg config.Database) (gorm.Dialector, error)
+
+var (
+	driverMu sync.RWMutex
+	drivers  = map[string]Driver{
+		"mysql":    mysqlDriver,
+		"postgres": postgresDriver,
+		"sqlite":   sqliteDriver,
+	}
+
+	dbList = make(map[string]*gorm.DB)
+)
+
+// RegisterDriver registers the driver of a database type, e.g. a dialector of gorm.io/driver/sqlserver:
+//
+//	database.RegisterDriver("sqlserver", func(cfg config.Database) (gorm.Dialector, error) {
+//		return sqlserver.Open(fmt.Sprintf("sqlserver://%s:%s@%s:%d?database=%s", cfg.User, cfg.Pass, cfg.Host, cfg.Port, cfg.DB)), nil
+//	})
+func RegisterDriver(typ string, d Driver) {
+	driverMu.Lock()
+	drivers[typ] = d
+	driverMu.Unlock()
+}
+
+func getDriver(typ string) (Driver, error) {
+	driverMu.RLock()
+	defer driverMu.RUnlock()
+	d, ok := drivers[typ]
+	if !ok {
+		return nil, fmt.Errorf("not found type = %v", typ)
+	}
+	return d, nil
+}
+
+// open connects the database cfg with drv, sets its pool, replicas and tracing, and keeps it by name
+func open(cfg config.Database, drv Driver) error {
+	dialector, err := drv(cfg)
+	if err != nil {
+		return err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		closePool(db)
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	setPool(sqlDB, cfg)
+	var r *resolver
+	if len(cfg.Replicas) > 0 {
+		r, err = newResolver(cfg, drv)
+		if err != nil {
+			sqlDB.Close()
+			return err
+		}
+		if err = r.register(db); err != nil {
+			r.close()
+			sqlDB.Close()
+			return err
+		}
+	}
+	if tracing.Enabled() {
+		if err = registerTracing(db, cfg.Type, cfg.DB); err != nil {
+			if r != nil {
+				r.close()
+			}
+			sqlDB.Close()
+			return err
+		}
+	}
+	if r != nil {
+		r.watch(cfg.HealthInterval)
+	}
+	dbList[cfg.Name] = db
+	return nil
+}
+
+// closePool closes the pool gorm.Open opened before failing
+func closePool(db *gorm.DB) {
+	if db == nil || db.ConnPool == nil {
+		return
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// setPool applies the pool settings of cfg to db
+func setPool(db *sql.DB, cfg config.Database) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+}
+
+// Get returns the connection of a database of any type
+func Get(name string) *gorm.DB {
+	return dbList[name].WithContext(context.Background())
+}
+
+// GetContext returns the connection running its statements with ctx, the spans of the statements are children of ctx
+func GetContext(ctx context.Context, name string) *gorm.DB {
+	return dbList[name].WithContext(ctx)
+}
@@ -3,24 +3,84 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
 	"github.com/liuyp5181/base/config"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-var mysqlList = make(map[string]*gorm.DB)
+const mysqlPort = 3306
 
-func ConnectMysql(cfg config.Database) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local", cfg.User, cfg.Pass, cfg.Host, cfg.Port, cfg.DB)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+// mysqlDSN returns the DSN of cfg, the charset is utf8mb4 and the time zone Local unless configured
+func mysqlDSN(cfg config.Database) (string, error) {
+	c := gomysql.NewConfig()
+	c.User = cfg.User
+	c.Passwd = cfg.Pass
+	c.Net = "tcp"
+	c.Addr = fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	c.DBName = cfg.DB
+	c.ParseTime = true
+	c.Timeout = cfg.DialTimeout
+	c.ReadTimeout = cfg.ReadTimeout
+	c.WriteTimeout = cfg.WriteTimeout
+	c.Collation = cfg.Collation
+	c.TLSConfig = cfg.TLS
+
+	var tz = cfg.TimeZone
+	if tz == "" {
+		tz = "Local"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return "", fmt.Errorf("load time zone %s failed, err = %v", tz, err)
+	}
+	c.Loc = loc
+
+	// the charset param runs SET NAMES after the handshake, which resets the collation of the handshake
+	// to the default one of the charset
+	c.Params = map[string]string{}
+	switch {
+	case cfg.Charset != "" && cfg.Collation != "":
+		c.Params["charset"] = cfg.Charset
+		c.Params["collation_connection"] = cfg.Collation
+	case cfg.Charset != "":
+		c.Params["charset"] = cfg.Charset
+	case cfg.Collation == "":
+		c.Params["charset"] = "utf8mb4"
+	}
+	for k, v := range cfg.Params {
+		c.Params[k] = v
+	}
+	return c.FormatDSN(), nil
+}
+
+func mysqlDriver(cfg config.Database) (gorm.Dialector, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("mysql [%s] host is empty", cfg.Name)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = mysqlPort
+	}
+	dsn, err := mysqlDSN(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	mysqlList[cfg.Name] = db
-	return nil
+	return mysql.Open(dsn), nil
+}
+
+func ConnectMysql(cfg config.Database) error {
+	cfg.Type = "mysql"
+	return open(cfg, mysqlDriver)
 }
 
 func GetMysql(name string) *gorm.DB {
 	// todo ping
-	return mysqlList[name].WithContext(context.Background())
+	return Get(name)
+}
+
+// GetMysqlContext returns the connection running its statements with ctx, the spans of the statements are children of ctx
+func GetMysqlContext(ctx context.Context, name string) *gorm.DB {
+	return GetContext(ctx, name)
 }
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/liuyp5181/base/config"
+)
+
+func TestMysqlDSN(t *testing.T) {
+	base := config.Database{Name: "order", Host: "db", Port: 3306, User: "u", Pass: "p", DB: "order"}
+	tests := []struct {
+		name      string
+		edit      func(c *config.Database)
+		params    map[string]string
+		collation string
+		loc       string
+		err       string
+	}{
+		{
+			name:      "defaults",
+			params:    map[string]string{"charset": "utf8mb4"},
+			collation: "utf8mb4_general_ci",
+			loc:       "Local",
+		},
+		{
+			name:      "charset",
+			edit:      func(c *config.Database) { c.Charset = "latin1" },
+			params:    map[string]string{"charset": "latin1"},
+			collation: "utf8mb4_general_ci",
+			loc:       "Local",
+		},
+		{
+			// the collation of the handshake is not reset by SET NAMES
+			name:      "collation",
+			edit:      func(c *config.Database) { c.Collation = "utf8mb4_unicode_ci" },
+			params:    map[string]string{},
+			collation: "utf8mb4_unicode_ci",
+			loc:       "Local",
+		},
+		{
+			name:      "charset and collation",
+			edit:      func(c *config.Database) { c.Charset, c.Collation = "utf8mb4", "utf8mb4_bin" },
+			params:    map[string]string{"charset": "utf8mb4", "collation_connection": "utf8mb4_bin"},
+			collation: "utf8mb4_bin",
+			loc:       "Local",
+		},
+		{
+			name: "params",
+			edit: func(c *config.Database) {
+				c.Params = map[string]string{"charset": "utf8", "sql_mode": "'TRADITIONAL'"}
+				c.TimeZone = "UTC"
+			},
+			params:    map[string]string{"charset": "utf8", "sql_mode": "'TRADITIONAL'"},
+			collation: "utf8mb4_general_ci",
+			loc:       "UTC",
+		},
+		{
+			name: "invalid time zone",
+			edit: func(c *config.Database) { c.TimeZone = "Mars/Olympus" },
+			err:  "load time zone Mars/Olympus failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			if tt.edit != nil {
+				tt.edit(&cfg)
+			}
+			dsn, err := mysqlDSN(cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("mysqlDSN err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mysqlDSN err = %v", err)
+			}
+			c, err := gomysql.ParseDSN(dsn)
+			if err != nil {
+				t.Fatalf("ParseDSN(%s) err = %v", dsn, err)
+			}
+			if c.Params == nil {
+				c.Params = map[string]string{}
+			}
+			if !reflect.DeepEqual(c.Params, tt.params) {
+				t.Errorf("params = %v, want %v", c.Params, tt.params)
+			}
+			if c.Collation != tt.collation {
+				t.Errorf("collation = %s, want %s", c.Collation, tt.collation)
+			}
+			if c.Loc.String() != tt.loc {
+				t.Errorf("loc = %s, want %s", c.Loc, tt.loc)
+			}
+			if c.Addr != "db:3306" || c.DBName != "order" || !c.ParseTime {
+				t.Errorf("dsn = %s", dsn)
+			}
+		})
+	}
+}
+
+func TestMysqlDSNTimeouts(t *testing.T) {
+	cfg := config.Database{Host: "db", Port: 3306, DialTimeout: 5 * time.Second, ReadTimeout: time.Second}
+	dsn, err := mysqlDSN(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := gomysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Timeout != 5*time.Second || c.ReadTimeout != time.Second || c.WriteTimeout != 0 {
+		t.Fatalf("timeouts = %v %v %v, dsn = %s", c.Timeout, c.ReadTimeout, c.WriteTimeout, dsn)
+	}
+}
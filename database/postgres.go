@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/liuyp5181/base/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const postgresPort = 5432
+
+// sslModes maps the tls values of the mysql entries to the sslmode of postgres, other values are
+// used as they are, e.g. verify-full
+var sslModes = map[string]string{
+	"true":        "verify-full",
+	"false":       "disable",
+	"skip-verify": "require",
+	"preferred":   "prefer",
+}
+
+// postgresDSN returns the URL of cfg. Charset, collation and the read and write timeouts are mysql
+// settings and are not used
+func postgresDSN(cfg config.Database) string {
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:   "/" + cfg.DB,
+	}
+	if cfg.User != "" {
+		u.User = url.UserPassword(cfg.User, cfg.Pass)
+	}
+
+	q := url.Values{}
+	if cfg.TLS != "" {
+		mode, ok := sslModes[cfg.TLS]
+		if !ok {
+			mode = cfg.TLS
+		}
+		q.Set("sslmode", mode)
+	}
+	if cfg.DialTimeout > 0 {
+		q.Set("connect_timeout", strconv.Itoa(int((cfg.DialTimeout+time.Second-1)/time.Second)))
+	}
+	if cfg.TimeZone != "" && cfg.TimeZone != "Local" {
+		q.Set("TimeZone", cfg.TimeZone)
+	}
+	for k, v := range cfg.Params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func postgresDriver(cfg config.Database) (gorm.Dialector, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("postgres [%s] host is empty", cfg.Name)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = postgresPort
+	}
+	return postgres.Open(postgresDSN(cfg)), nil
+}
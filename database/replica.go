@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/liuyp5181/base/config"
+	"github.com/liuyp5181/base/log"
+	"github.com/liuyp5181/base/signal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	pingTimeout           = 3 * time.Second
+	defaultHealthInterval = 10 * time.Second
+)
+
+type primaryKey struct{}
+
+// WithPrimary returns a context sending the reads to the primary, e.g. to read what was just written:
+//
+//	database.GetMysqlContext(database.WithPrimary(ctx), name).First(&user, id)
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+type replica struct {
+	addr string
+	cfg  config.Database
+	// db is nil until the replica is opened by a health check
+	db      atomic.Pointer[sql.DB]
+	healthy bool
+}
+
+// resolver sends the reads outside of transactions to the healthy replicas, and the other statements
+// to the primary. The reads go to the primary when no replica is healthy
+type resolver struct {
+	typ      string
+	name     string
+	policy   string
+	drv      Driver
+	primary  gorm.ConnPool
+	replicas []*replica
+	healthy  atomic.Pointer[[]*replica]
+	next     atomic.Uint64
+}
+
+// newResolver checks the config of the replicas of cfg and runs the first health check. The replicas
+// are opened by the health checks, so those down at startup are used once they answer
+func newResolver(cfg config.Database, drv Driver) (*resolver, error) {
+	r := &resolver{typ: cfg.Type, name: cfg.Name, policy: cfg.Policy, drv: drv}
+	for _, rc := range cfg.Replicas {
+		c := cfg
+		c.Host = rc.Host
+		if rc.Port != 0 {
+			c.Port = rc.Port
+		}
+		if rc.User != "" {
+			c.User = rc.User
+		}
+		if rc.Pass != "" {
+			c.Pass = rc.Pass
+		}
+		// the dialector is only created to report an invalid config now
+		if _, err := drv(c); err != nil {
+			return nil, err
+		}
+		var addr = c.Host
+		if c.Port != 0 {
+			addr = fmt.Sprintf("%s:%d", c.Host, c.Port)
+		}
+		r.replicas = append(r.replicas, &replica{addr: addr, cfg: c, healthy: true})
+	}
+	r.check()
+	return r, nil
+}
+
+// open opens the pool of a replica, the dialector may query the server, e.g. the version of mysql
+func (r *resolver) open(rep *replica) (*sql.DB, error) {
+	dialector, err := r.drv(rep.cfg)
+	if err != nil {
+		return nil, err
+	}
+	// the statements of the replica are logged by the primary
+	gdb, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		closePool(gdb)
+		return nil, err
+	}
+	db, err := gdb.DB()
+	if err != nil {
+		return nil, err
+	}
+	setPool(db, rep.cfg)
+	return db, nil
+}
+
+// register routes the statements of db, which must be the primary
+func (r *resolver) register(db *gorm.DB) error {
+	r.primary = db.ConnPool
+	cb := db.Callback()
+	return errors.Join(
+		cb.Query().Before("gorm:query").Register("replica:query", r.read),
+		cb.Row().Before("gorm:row").Register("replica:row", r.read),
+		cb.Create().Before("gorm:create").Register("replica:create", r.write),
+		cb.Update().Before("gorm:update").Register("replica:update", r.write),
+		cb.Delete().Before("gorm:delete").Register("replica:delete", r.write),
+		cb.Raw().Before("gorm:raw").Register("replica:raw", r.write),
+	)
+}
+
+func (r *resolver) read(db *gorm.DB) {
+	stmt := db.Statement
+	if _, ok := stmt.ConnPool.(gorm.TxCommitter); ok {
+		return
+	}
+	if _, ok := stmt.Clauses["FOR"]; ok || usePrimary(stmt.Context) {
+		stmt.ConnPool = r.primary
+		return
+	}
+	if rep := r.pick(); rep != nil {
+		stmt.ConnPool = rep.db.Load()
+	} else {
+		stmt.ConnPool = r.primary
+	}
+}
+
+// write sends the statement back to the primary when an earlier read of the same chain used a replica
+func (r *resolver) write(db *gorm.DB) {
+	if r.isReplica(db.Statement.ConnPool) {
+		db.Statement.ConnPool = r.primary
+	}
+}
+
+func (r *resolver) isReplica(pool gorm.ConnPool) bool {
+	db, ok := pool.(*sql.DB)
+	if !ok {
+		return false
+	}
+	for _, rep := range r.replicas {
+		if db == rep.db.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *resolver) pick() *replica {
+	list := r.healthy.Load()
+	if list == nil || len(*list) == 0 {
+		return nil
+	}
+	if r.policy == "round_robin" {
+		return (*list)[(r.next.Add(1)-1)%uint64(len(*list))]
+	}
+	return (*list)[rand.Intn(len(*list))]
+}
+
+// check opens the replicas that are not yet, pings them and updates the healthy ones
+func (r *resolver) check() {
+	var list []*replica
+	for _, rep := range r.replicas {
+		db := rep.db.Load()
+		var err error
+		if db == nil {
+			if db, err = r.open(rep); err == nil {
+				rep.db.Store(db)
+			}
+		}
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			err = db.PingContext(ctx)
+			cancel()
+		}
+		switch {
+		case err != nil && rep.healthy:
+			log.Warningf("%s [%s] replica %s is unhealthy, removed, err = %v", r.typ, r.name, rep.addr, err)
+		case err == nil && !rep.healthy:
+			log.Infof("%s [%s] replica %s is healthy again, added back", r.typ, r.name, rep.addr)
+		}
+		rep.healthy = err == nil
+		if rep.healthy {
+			list = append(list, rep)
+		}
+	}
+	r.healthy.Store(&list)
+}
+
+// watch pings the replicas every interval until the process is closed
+func (r *resolver) watch(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signal.RegisterClose(cancel)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				r.close()
+				return
+			case <-ticker.C:
+				r.check()
+			}
+		}
+	}()
+}
+
+func (r *resolver) close() {
+	for _, rep := range r.replicas {
+		if db := rep.db.Load(); db != nil {
+			db.Close()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"github.com/liuyp5181/base/config"
+	"gorm.io/gorm"
+)
+
+// sqliteDSN returns the file of cfg.DB with the params. The database ":memory:" is an in-memory
+// database shared by the connections of the entry and dropped with its last connection, e.g. for tests:
+//
+//	database.Connect("order", database.WithType("sqlite"), database.WithDB(":memory:"))
+func sqliteDSN(cfg config.Database) string {
+	var dsn = cfg.DB
+	q := url.Values{}
+	if dsn == ":memory:" {
+		dsn = "file:" + cfg.Name
+		q.Set("mode", "memory")
+		q.Set("cache", "shared")
+	}
+	for k, v := range cfg.Params {
+		q.Set(k, v)
+	}
+	if len(q) == 0 {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + q.Encode()
+	}
+	return dsn + "?" + q.Encode()
+}
+
+// sqliteDriver opens sqlite with a pure Go driver, the binaries build without cgo
+func sqliteDriver(cfg config.Database) (gorm.Dialector, error) {
+	if cfg.DB == "" {
+		return nil, fmt.Errorf("sqlite [%s] db is empty", cfg.Name)
+	}
+	return sqlite.Open(sqliteDSN(cfg)), nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/liuyp5181/base/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// registerTracing adds callbacks starting a span around every gorm operation, the span is a child of
+// the context passed with db.WithContext
+func registerTracing(db *gorm.DB, system, name string) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", beforeCallback("create", system, name)),
+		cb.Create().After("gorm:create").Register("tracing:after_create", afterCallback),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", beforeCallback("query", system, name)),
+		cb.Query().After("gorm:query").Register("tracing:after_query", afterCallback),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", beforeCallback("update", system, name)),
+		cb.Update().After("gorm:update").Register("tracing:after_update", afterCallback),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", beforeCallback("delete", system, name)),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", afterCallback),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", beforeCallback("row", system, name)),
+		cb.Row().After("gorm:row").Register("tracing:after_row", afterCallback),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", beforeCallback("raw", system, name)),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", afterCallback),
+	)
+}
+
+func beforeCallback(op, system, name string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		_, span := tracing.Start(db.Statement.Context, "gorm."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("db.system", system),
+			attribute.String("db.name", name),
+			attribute.String("db.operation", op),
+		))
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func afterCallback(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	span.SetAttributes(attribute.String("db.sql.table", db.Statement.Table))
+	span.SetAttributes(attribute.String("db.statement", db.Statement.SQL.String()))
+	span.SetAttributes(attribute.Int64("db.rows_affected", db.RowsAffected))
+
+	var err = db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
@@ -0,0 +1,275 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/liuyp5181/base/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const (
+	electionKey        = "elections"
+	defaultElectionTTL = 10
+)
+
+// ErrNotLeader is returned by Resign when this candidate is not the leader
+var ErrNotLeader = errors.New("etcd: not leader")
+
+// Election elects one leader among the candidates of the same name. Leadership is backed by a lease
+// kept alive while leading, it is lost when the leader stops renewing it
+type Election struct {
+	sync.Mutex
+	name     string
+	id       string
+	ttl      int
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+type ElectionOption func(*Election)
+
+// WithElectionTTL sets the lease TTL in seconds, another candidate is elected this long after the
+// leader stops renewing it, 10 by default
+func WithElectionTTL(ttl int) ElectionOption {
+	return func(e *Election) {
+		e.ttl = ttl
+	}
+}
+
+// WithIdentity sets the value identifying this candidate when it is the leader, hostname:pid by default
+func WithIdentity(id string) ElectionOption {
+	return func(e *Election) {
+		e.id = id
+	}
+}
+
+// ElectionInfo describes an election of this process
+type ElectionInfo struct {
+	Name     string `json:"name"`
+	Identity string `json:"identity"`
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"is_leader"`
+}
+
+var (
+	electionMu   sync.Mutex
+	electionList []*Election
+)
+
+func NewElection(name string, opts ...ElectionOption) *Election {
+	host, _ := os.Hostname()
+	e := &Election{
+		name: name,
+		id:   fmt.Sprintf("%s:%d", host, os.Getpid()),
+		ttl:  defaultElectionTTL,
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	electionMu.Lock()
+	electionList = append(electionList, e)
+	electionMu.Unlock()
+	return e
+}
+
+// prefix is the prefix of the candidates, the name is escaped so that the election a does not see the
+// candidates of a/b
+func (e *Election) prefix() string {
+	return fmt.Sprintf("%s/%s/", electionKey, escapeKey(e.name))
+}
+
+// Campaign blocks until this candidate is elected or ctx is done
+func (e *Election) Campaign(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+	if e.election != nil {
+		select {
+		case <-e.session.Done():
+			// leadership was lost, campaign again with a new session
+			e.release()
+		default:
+			return nil
+		}
+	}
+
+	s, err := concurrency.NewSession(client, concurrency.WithTTL(e.ttl), concurrency.WithContext(context.Background()))
+	if err != nil {
+		return fmt.Errorf("create session failed, err = %v", err)
+	}
+	el := concurrency.NewElection(s, e.prefix())
+	if err = el.Campaign(ctx, e.id); err != nil {
+		s.Close()
+		return err
+	}
+	e.session = s
+	e.election = el
+	log.Infof("election %s elected %s", e.name, e.id)
+	return nil
+}
+
+// Resign gives up leadership so that another candidate can be elected
+func (e *Election) Resign(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+	if e.election == nil {
+		return ErrNotLeader
+	}
+	err := e.election.Resign(ctx)
+	e.release()
+	return err
+}
+
+func (e *Election) release() {
+	e.session.Close()
+	e.session = nil
+	e.election = nil
+}
+
+// IsLeader reports whether this candidate holds the leadership, without asking etcd
+func (e *Election) IsLeader() bool {
+	e.Lock()
+	defer e.Unlock()
+	if e.election == nil {
+		return false
+	}
+	select {
+	case <-e.session.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// Done is closed when the leadership is lost or resigned. It returns nil when this candidate is not the leader
+func (e *Election) Done() <-chan struct{} {
+	e.Lock()
+	defer e.Unlock()
+	if e.session == nil {
+		return nil
+	}
+	return e.session.Done()
+}
+
+// Leader returns the identity of the current leader, or "" when there is none
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	resp, err := client.Get(ctx, e.prefix(), clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	return leaderOf(resp), nil
+}
+
+func leaderOf(resp *clientv3.GetResponse) string {
+	if len(resp.Kvs) == 0 {
+		return ""
+	}
+	return string(resp.Kvs[0].Value)
+}
+
+// Observe returns a channel receiving the identity of the leader every time it changes, "" when there
+// is none. The channel is closed when ctx is done
+func (e *Election) Observe(ctx context.Context) <-chan string {
+	var ch = make(chan string)
+	go func() {
+		defer close(ch)
+		resp, err := client.Get(ctx, e.prefix(), clientv3.WithFirstCreate()...)
+		if err != nil {
+			log.Errorf("election %s get leader failed, err = %v", e.name, err)
+			return
+		}
+		var last = leaderOf(resp)
+		select {
+		case ch <- last:
+		case <-ctx.Done():
+			return
+		}
+
+		// watch from the revision of the first leader so that no change is missed
+		wc := client.Watch(ctx, e.prefix(), clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for range wc {
+			leader, err := e.Leader(ctx)
+			if err != nil {
+				log.Errorf("election %s get leader failed, err = %v", e.name, err)
+				continue
+			}
+			if leader == last {
+				continue
+			}
+			select {
+			case ch <- leader:
+			case <-ctx.Done():
+				return
+			}
+			last = leader
+		}
+	}()
+	return ch
+}
+
+// RunAsLeader campaigns and runs fn once elected. The context of fn is canceled when the leadership is
+// lost, fn is then run again after the next election. RunAsLeader resigns and returns the error of fn
+// when fn returns while still leading, or the error of ctx when ctx is done
+func (e *Election) RunAsLeader(ctx context.Context, fn func(ctx context.Context) error) error {
+	for {
+		if err := e.Campaign(ctx); err != nil {
+			return err
+		}
+		done := e.Done()
+		lctx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-done:
+			case <-lctx.Done():
+			}
+			cancel()
+		}()
+
+		err := fn(lctx)
+		cancel()
+		select {
+		case <-done:
+			if ctx.Err() == nil {
+				log.Warningf("election %s leadership lost, err = %v", e.name, err)
+				continue
+			}
+		default:
+		}
+		e.Resign(context.Background())
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+}
+
+// Elections returns the elections of this process with their current leader
+func Elections(ctx context.Context) []ElectionInfo {
+	electionMu.Lock()
+	var list = make([]*Election, len(electionList))
+	copy(list, electionList)
+	electionMu.Unlock()
+
+	var res = make([]ElectionInfo, 0, len(list))
+	for _, e := range list {
+		leader, err := e.Leader(ctx)
+		if err != nil {
+			log.Errorf("election %s get leader failed, err = %v", e.name, err)
+		}
+		res = append(res, ElectionInfo{
+			Name:     e.name,
+			Identity: e.id,
+			Leader:   leader,
+			IsLeader: e.IsLeader(),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
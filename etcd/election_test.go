@@ -0,0 +1,30 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestElectionNames(t *testing.T) {
+	ctx := context.Background()
+	parent := NewElection("test-election", WithIdentity("parent"))
+	child := NewElection("test-election/child", WithIdentity("child"))
+	if err := child.Campaign(ctx); err != nil {
+		t.Fatalf("child.Campaign err = %v", err)
+	}
+	defer child.Resign(ctx)
+
+	// the candidates of test-election/child are not candidates of test-election
+	if leader, err := parent.Leader(ctx); leader != "" || err != nil {
+		t.Fatalf("parent.Leader = %q, %v, want no leader", leader, err)
+	}
+	if err := parent.Campaign(ctx); err != nil {
+		t.Fatalf("parent.Campaign err = %v", err)
+	}
+	defer parent.Resign(ctx)
+	for _, e := range []*Election{parent, child} {
+		if leader, err := e.Leader(ctx); err != nil || leader != e.id {
+			t.Errorf("%s Leader = %q, %v, want %q", e.name, leader, err, e.id)
+		}
+	}
+}
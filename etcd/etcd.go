@@ -1,20 +1,111 @@
 package etcd
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/liuyp5181/base/log"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+const (
+	defaultDialTimeout    = 5 * time.Second
+	defaultRequestTimeout = 5 * time.Second
+)
+
+// Config is the address of an etcd endpoint
 type Config struct {
-	IP   string `mapstructure:"ip"`
-	Port int    `mapstructure:"port"`
+	IP   string `mapstructure:"ip" validate:"required"`
+	Port int    `mapstructure:"port" validate:"required,min=1,max=65535"`
+}
+
+// ClientConfig is the connection to the etcd cluster
+type ClientConfig struct {
+	Endpoints []Config   `mapstructure:"endpoints" validate:"required"`
+	Username  string     `mapstructure:"username"`
+	Password  string     `mapstructure:"password"`
+	TLS       *TLSConfig `mapstructure:"tls"`
+	// DialTimeout bounds the first connection, 5s by default
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	// RequestTimeout bounds the requests made without a caller context, 5s by default
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// AutoSyncInterval updates the endpoints from the cluster membership, disabled when 0
+	AutoSyncInterval time.Duration `mapstructure:"auto_sync_interval"`
+}
+
+// TLSConfig enables TLS to the cluster, Cert and Key are the client certificate
+type TLSConfig struct {
+	CA                 string `mapstructure:"ca"`
+	Cert               string `mapstructure:"cert"`
+	Key                string `mapstructure:"key"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// ClientV3 returns the clientv3 config of c
+func (c ClientConfig) ClientV3() (clientv3.Config, error) {
+	var points []string
+	for _, v := range c.Endpoints {
+		points = append(points, fmt.Sprintf("%s:%d", v.IP, v.Port))
+	}
+	var ec = clientv3.Config{
+		Endpoints:        points,
+		DialTimeout:      c.DialTimeout,
+		AutoSyncInterval: c.AutoSyncInterval,
+		Username:         c.Username,
+		Password:         c.Password,
+	}
+	if ec.DialTimeout <= 0 {
+		ec.DialTimeout = defaultDialTimeout
+	}
+	if c.TLS != nil {
+		info := transport.TLSInfo{
+			CertFile:           c.TLS.Cert,
+			KeyFile:            c.TLS.Key,
+			TrustedCAFile:      c.TLS.CA,
+			ServerName:         c.TLS.ServerName,
+			InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+		}
+		tc, err := info.ClientConfig()
+		if err != nil {
+			return ec, fmt.Errorf("load etcd tls failed, err = %v", err)
+		}
+		ec.TLS = tc
+	}
+	return ec, nil
+}
+
+// String hides the password
+func (c ClientConfig) String() string {
+	var pass string
+	if c.Password != "" {
+		pass = "******"
+	}
+	return fmt.Sprintf("{Endpoints:%v Username:%s Password:%s TLS:%+v DialTimeout:%v RequestTimeout:%v AutoSyncInterval:%v}",
+		c.Endpoints, c.Username, pass, c.TLS, c.DialTimeout, c.RequestTimeout, c.AutoSyncInterval)
 }
 
 var (
-	client *clientv3.Client
-	isInit bool
+	client         *clientv3.Client
+	isInit         bool
+	requestTimeout = defaultRequestTimeout
 )
 
+// InitConfig connects to the cluster described by c
+func InitConfig(c ClientConfig) error {
+	ec, err := c.ClientV3()
+	if err != nil {
+		return err
+	}
+	if c.RequestTimeout > 0 {
+		requestTimeout = c.RequestTimeout
+	}
+	return Init(ec)
+}
+
 func Init(conf clientv3.Config) error {
 	log.Info("etcd init", isInit)
 	if isInit == true {
@@ -38,3 +129,15 @@ func Init(conf clientv3.Config) error {
 func GetClient() *clientv3.Client {
 	return client
 }
+
+// requestContext bounds a request made without a caller context by the request timeout
+func requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), requestTimeout)
+}
+
+var keyEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// escapeKey escapes the / of a name used as one segment of a key, and the % escaping it
+func escapeKey(name string) string {
+	return keyEscaper.Replace(name)
+}
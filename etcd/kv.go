@@ -0,0 +1,337 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/liuyp5181/base/log"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	kvKey              = "kv"
+	watchRetryInterval = time.Second
+)
+
+var (
+	// ErrKeyNotFound is returned by Get when the key does not exist
+	ErrKeyNotFound = errors.New("etcd: key not found")
+	// ErrRevisionMismatch is returned by CompareAndSwap when the key was modified since the given revision
+	ErrRevisionMismatch = errors.New("etcd: revision mismatch")
+)
+
+// Codec converts the values of a KV to and from bytes
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// JSONCodec encodes values with encoding/json
+func JSONCodec[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+type protoCodec[T proto.Message] struct{}
+
+func (protoCodec[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (protoCodec[T]) Unmarshal(data []byte) (T, error) {
+	var zero T
+	v := zero.ProtoReflect().Type().New().Interface().(T)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
+
+// ProtoCodec encodes values in the protobuf wire format, T is a generated message pointer type
+func ProtoCodec[T proto.Message]() Codec[T] {
+	return protoCodec[T]{}
+}
+
+// KV stores values of type T under kv/<name>/ in etcd
+type KV[T any] struct {
+	prefix string
+	codec  Codec[T]
+}
+
+// Entry is a value of a KV with its etcd revisions
+type Entry[T any] struct {
+	Key   string
+	Value T
+	// Revision is the revision of the last modification, used by CompareAndSwap
+	Revision       int64
+	CreateRevision int64
+	Version        int64
+	Lease          int64
+}
+
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+	// EventCompacted is sent when the revisions the watch had to resume from were compacted, the
+	// changes made before Revision are lost and the caller should List the keys again
+	EventCompacted
+)
+
+// Event is a change of a KV, the Value of a delete event is the deleted value when it is known
+type Event[T any] struct {
+	Type EventType
+	Entry[T]
+}
+
+type putOptions struct {
+	ttl int64
+}
+
+type PutOption func(*putOptions)
+
+// WithTTL attaches the key to a lease of ttl seconds, the key is deleted when the lease expires
+func WithTTL(ttl int64) PutOption {
+	return func(o *putOptions) {
+		o.ttl = ttl
+	}
+}
+
+// NewKV returns the KV named name, values are encoded with codec or with JSON when codec is nil
+func NewKV[T any](name string, codec Codec[T]) *KV[T] {
+	if codec == nil {
+		codec = JSONCodec[T]()
+	}
+	return &KV[T]{
+		prefix: fmt.Sprintf("%s/%s/", kvKey, name),
+		codec:  codec,
+	}
+}
+
+func (kv *KV[T]) entry(v *mvccpb.KeyValue) (*Entry[T], error) {
+	val, err := kv.codec.Unmarshal(v.Value)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s failed, err = %v", v.Key, err)
+	}
+	return &Entry[T]{
+		Key:            strings.TrimPrefix(string(v.Key), kv.prefix),
+		Value:          val,
+		Revision:       v.ModRevision,
+		CreateRevision: v.CreateRevision,
+		Version:        v.Version,
+		Lease:          v.Lease,
+	}, nil
+}
+
+func (kv *KV[T]) Get(ctx context.Context, key string) (*Entry[T], error) {
+	resp, err := client.Get(ctx, kv.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return kv.entry(resp.Kvs[0])
+}
+
+// Put stores v and returns the revision of the modification
+func (kv *KV[T]) Put(ctx context.Context, key string, v T, opts ...PutOption) (int64, error) {
+	op, lease, err := kv.putOp(ctx, key, v, opts)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(ctx, op)
+	if err != nil {
+		revoke(lease)
+		return 0, err
+	}
+	return resp.Put().Header.Revision, nil
+}
+
+// putOp returns the put of v and the lease granted for its ttl, which must be revoked when the put
+// is not applied
+func (kv *KV[T]) putOp(ctx context.Context, key string, v T, opts []PutOption) (clientv3.Op, clientv3.LeaseID, error) {
+	var o putOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	data, err := kv.codec.Marshal(v)
+	if err != nil {
+		return clientv3.Op{}, clientv3.NoLease, fmt.Errorf("encode %s failed, err = %v", key, err)
+	}
+	var ops []clientv3.OpOption
+	var lease = clientv3.NoLease
+	if o.ttl > 0 {
+		resp, err := client.Grant(ctx, o.ttl)
+		if err != nil {
+			return clientv3.Op{}, clientv3.NoLease, fmt.Errorf("grant lease failed, err = %v", err)
+		}
+		lease = resp.ID
+		ops = append(ops, clientv3.WithLease(lease))
+	}
+	return clientv3.OpPut(kv.prefix+key, string(data), ops...), lease, nil
+}
+
+// revoke revokes the lease of a put that was not applied, it would otherwise live until its ttl
+func revoke(lease clientv3.LeaseID) {
+	if lease == clientv3.NoLease {
+		return
+	}
+	ctx, cancel := requestContext()
+	defer cancel()
+	if _, err := client.Revoke(ctx, lease); err != nil {
+		log.Warningf("kv revoke lease %x failed, err = %v", lease, err)
+	}
+}
+
+// Delete deletes key and reports whether it existed
+func (kv *KV[T]) Delete(ctx context.Context, key string) (bool, error) {
+	resp, err := client.Delete(ctx, kv.prefix+key)
+	if err != nil {
+		return false, err
+	}
+	return resp.Deleted > 0, nil
+}
+
+// CompareAndSwap stores v only when the key was last modified at revision rev, or does not exist when
+// rev is 0. It returns the revision of the modification or ErrRevisionMismatch
+func (kv *KV[T]) CompareAndSwap(ctx context.Context, key string, v T, rev int64, opts ...PutOption) (int64, error) {
+	op, lease, err := kv.putOp(ctx, key, v, opts)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(kv.prefix+key), "=", rev)).
+		Then(op).
+		Commit()
+	if err != nil {
+		revoke(lease)
+		return 0, err
+	}
+	if !resp.Succeeded {
+		revoke(lease)
+		return 0, ErrRevisionMismatch
+	}
+	return resp.Header.Revision, nil
+}
+
+// List returns the entries whose key starts with prefix, sorted by key
+func (kv *KV[T]) List(ctx context.Context, prefix string) ([]*Entry[T], error) {
+	resp, err := client.Get(ctx, kv.prefix+prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+	var list = make([]*Entry[T], 0, len(resp.Kvs))
+	for _, v := range resp.Kvs {
+		e, err := kv.entry(v)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+// Watch delivers the changes of the keys starting with prefix made after revision rev, or from now
+// when rev is 0. The watch is resumed from the last delivered revision when the connection is lost,
+// or from the compaction after an EventCompacted when that revision was compacted. Values that can
+// not be decoded are skipped. The channel is closed when ctx is done
+func (kv *KV[T]) Watch(ctx context.Context, prefix string, rev int64) <-chan Event[T] {
+	var ch = make(chan Event[T])
+	go func() {
+		defer close(ch)
+		var next = rev + 1
+		for ctx.Err() == nil {
+			if rev == 0 && next == 1 {
+				// pin the current revision so that a reconnection does not miss any change
+				resp, err := client.Get(ctx, kv.prefix+prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+				if err != nil {
+					log.Errorf("kv watch %s get revision failed, err = %v", kv.prefix+prefix, err)
+				} else {
+					next = resp.Header.Revision + 1
+				}
+			}
+			opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithPrevKV()}
+			if next > 1 {
+				opts = append(opts, clientv3.WithRev(next))
+			}
+			// RequireLeader ends the watch when the member is partitioned instead of blocking silently
+			wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+			wc := client.Watch(wctx, kv.prefix+prefix, opts...)
+			for resp := range wc {
+				if resp.CompactRevision > 0 {
+					log.Warningf("kv watch %s compacted, resume from revision %d", kv.prefix+prefix, resp.CompactRevision)
+					next = resp.CompactRevision
+					var e = Event[T]{Type: EventCompacted}
+					e.Revision = resp.CompactRevision
+					select {
+					case ch <- e:
+					case <-ctx.Done():
+						cancel()
+						return
+					}
+					break
+				}
+				if err := resp.Err(); err != nil {
+					log.Errorf("kv watch %s failed, err = %v", kv.prefix+prefix, err)
+					break
+				}
+				for _, ev := range resp.Events {
+					e, ok := kv.event(ev)
+					next = ev.Kv.ModRevision + 1
+					if !ok {
+						continue
+					}
+					select {
+					case ch <- e:
+					case <-ctx.Done():
+						cancel()
+						return
+					}
+				}
+			}
+			cancel()
+			select {
+			case <-ctx.Done():
+			case <-time.After(watchRetryInterval):
+			}
+		}
+	}()
+	return ch
+}
+
+func (kv *KV[T]) event(ev *clientv3.Event) (Event[T], bool) {
+	if ev.Type == mvccpb.DELETE {
+		var e = Event[T]{Type: EventDelete}
+		e.Key = strings.TrimPrefix(string(ev.Kv.Key), kv.prefix)
+		e.Revision = ev.Kv.ModRevision
+		if ev.PrevKv != nil {
+			if v, err := kv.codec.Unmarshal(ev.PrevKv.Value); err == nil {
+				e.Value = v
+			}
+		}
+		return e, true
+	}
+	entry, err := kv.entry(ev.Kv)
+	if err != nil {
+		log.Errorf("kv watch %s skip event, err = %v", kv.prefix, err)
+		return Event[T]{}, false
+	}
+	return Event[T]{Type: EventPut, Entry: *entry}, true
+}
@@ -0,0 +1,204 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const (
+	lockKey        = "locks"
+	defaultLockTTL = 10
+)
+
+var (
+	// ErrLocked is returned by TryLock when the lock is held by another session
+	ErrLocked = errors.New("etcd: mutex is locked by another session")
+	// ErrNotLocked is returned when the mutex is not held
+	ErrNotLocked = errors.New("etcd: mutex is not locked")
+	// ErrLockLost is returned when the lease of the lock expired while it was held
+	ErrLockLost = errors.New("etcd: mutex lock lost")
+)
+
+// Mutex is a distributed lock on etcd. Each acquisition is backed by its own lease, kept alive
+// while the lock is held and revoked by Unlock, so the lock is released when the holder dies.
+// Token returns a fencing token increasing with every acquisition, writes to other systems should
+// carry it and be rejected when an older token is seen after a newer one
+type Mutex struct {
+	sync.Mutex
+	name    string
+	ttl     int
+	session *concurrency.Session
+	mu      *concurrency.Mutex
+	token   int64
+	// acquiring is set while Lock or TryLock waits on etcd, the other methods do not wait for it
+	acquiring bool
+}
+
+type MutexOption func(*Mutex)
+
+// WithLockTTL sets the lease TTL in seconds, the lock is released this long after the holder stops
+// renewing it, 10 by default
+func WithLockTTL(ttl int) MutexOption {
+	return func(m *Mutex) {
+		m.ttl = ttl
+	}
+}
+
+func NewMutex(name string, opts ...MutexOption) *Mutex {
+	m := &Mutex{
+		name: name,
+		ttl:  defaultLockTTL,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Lock blocks until the lock is acquired or ctx is done
+func (m *Mutex) Lock(ctx context.Context) error {
+	return m.lock(ctx, false)
+}
+
+// TryLock acquires the lock without waiting, it returns ErrLocked when another session holds it
+func (m *Mutex) TryLock(ctx context.Context) error {
+	return m.lock(ctx, true)
+}
+
+func (m *Mutex) lock(ctx context.Context, try bool) error {
+	m.Mutex.Lock()
+	if m.acquiring {
+		m.Mutex.Unlock()
+		return fmt.Errorf("mutex %s is already being acquired by this holder", m.name)
+	}
+	if m.mu != nil {
+		select {
+		case <-m.session.Done():
+			// the lease expired, acquire again with a new session
+			m.release()
+		default:
+			m.Mutex.Unlock()
+			return fmt.Errorf("mutex %s is already locked by this holder", m.name)
+		}
+	}
+	m.acquiring = true
+	m.Mutex.Unlock()
+
+	s, mu, token, err := m.acquire(ctx, try)
+
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.acquiring = false
+	if err != nil {
+		return err
+	}
+	m.session = s
+	m.mu = mu
+	m.token = token
+	return nil
+}
+
+// acquire waits for the lock on etcd with a new session, without holding the internal lock
+func (m *Mutex) acquire(ctx context.Context, try bool) (*concurrency.Session, *concurrency.Mutex, int64, error) {
+	s, err := concurrency.NewSession(client, concurrency.WithTTL(m.ttl), concurrency.WithContext(context.Background()))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("create session failed, err = %v", err)
+	}
+	// the name is escaped so that the lock a is not held by the holders of a/b
+	mu := concurrency.NewMutex(s, fmt.Sprintf("%s/%s", lockKey, escapeKey(m.name)))
+	if try {
+		err = mu.TryLock(ctx)
+	} else {
+		err = mu.Lock(ctx)
+	}
+	if err != nil {
+		s.Close()
+		if errors.Is(err, concurrency.ErrLocked) {
+			return nil, nil, 0, ErrLocked
+		}
+		return nil, nil, 0, err
+	}
+
+	// the create revision of the key of this session orders all the holders of the lock
+	resp, err := client.Get(ctx, mu.Key())
+	if err != nil || len(resp.Kvs) == 0 {
+		mu.Unlock(context.Background())
+		s.Close()
+		if err == nil {
+			err = ErrLockLost
+		}
+		return nil, nil, 0, err
+	}
+	return s, mu, resp.Kvs[0].CreateRevision, nil
+}
+
+// Unlock releases the lock and revokes its lease
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	if m.mu == nil {
+		return ErrNotLocked
+	}
+	err := m.mu.Unlock(ctx)
+	m.release()
+	return err
+}
+
+func (m *Mutex) release() {
+	m.session.Close()
+	m.session = nil
+	m.mu = nil
+	m.token = 0
+}
+
+// Token returns the fencing token of the current acquisition, the revision of the lock key, or 0
+// when the lock is not held
+func (m *Mutex) Token() int64 {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	return m.token
+}
+
+// Done is closed when the lease of the lock is lost or the lock is released. It returns nil when the
+// lock is not held
+func (m *Mutex) Done() <-chan struct{} {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	if m.session == nil {
+		return nil
+	}
+	return m.session.Done()
+}
+
+// IsOwner checks with etcd that the lock is still held by this holder
+func (m *Mutex) IsOwner(ctx context.Context) (bool, error) {
+	m.Mutex.Lock()
+	if m.mu == nil {
+		m.Mutex.Unlock()
+		return false, nil
+	}
+	key, token := m.mu.Key(), m.token
+	m.Mutex.Unlock()
+
+	resp, err := client.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Kvs) > 0 && resp.Kvs[0].CreateRevision == token, nil
+}
+
+// Txn returns a transaction on etcd that only succeeds while the lock is held, the operations in
+// Then are applied when the response is Succeeded
+func (m *Mutex) Txn(ctx context.Context) (clientv3.Txn, error) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	if m.mu == nil {
+		return nil, ErrNotLocked
+	}
+	return client.Txn(ctx).If(m.mu.IsOwner()), nil
+}
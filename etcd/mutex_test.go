@@ -0,0 +1,101 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMutex(t *testing.T) {
+	ctx := context.Background()
+	a, b := NewMutex("test-mutex"), NewMutex("test-mutex")
+	if err := a.Lock(ctx); err != nil {
+		t.Fatalf("a.Lock err = %v", err)
+	}
+	if err := b.TryLock(ctx); err != ErrLocked {
+		t.Fatalf("b.TryLock err = %v, want ErrLocked", err)
+	}
+
+	locked := make(chan error, 1)
+	go func() {
+		locked <- b.Lock(ctx)
+	}()
+	// wait for b to be queued on etcd
+	for {
+		b.Mutex.Lock()
+		acquiring := b.acquiring
+		b.Mutex.Unlock()
+		if acquiring {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the other methods of b answer while it waits for the lock
+	answered := make(chan struct{})
+	go func() {
+		defer close(answered)
+		if token := b.Token(); token != 0 {
+			t.Errorf("b.Token = %d while waiting, want 0", token)
+		}
+		if done := b.Done(); done != nil {
+			t.Error("b.Done is not nil while waiting")
+		}
+		if ok, err := b.IsOwner(ctx); ok || err != nil {
+			t.Errorf("b.IsOwner = %v, %v while waiting, want false", ok, err)
+		}
+		if err := b.Unlock(ctx); err != ErrNotLocked {
+			t.Errorf("b.Unlock err = %v while waiting, want ErrNotLocked", err)
+		}
+		if err := b.TryLock(ctx); err == nil {
+			t.Error("b.TryLock succeeded while b.Lock waits")
+		}
+	}()
+	select {
+	case <-answered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the methods of b block while b.Lock waits")
+	}
+
+	select {
+	case err := <-locked:
+		t.Fatalf("b.Lock returned %v while a holds the lock", err)
+	default:
+	}
+	tokenA := a.Token()
+	if err := a.Unlock(ctx); err != nil {
+		t.Fatalf("a.Unlock err = %v", err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatalf("b.Lock err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b.Lock did not return after a.Unlock")
+	}
+	if tokenB := b.Token(); tokenB <= tokenA {
+		t.Fatalf("b.Token = %d, want more than the token %d of a", tokenB, tokenA)
+	}
+	if ok, err := b.IsOwner(ctx); !ok || err != nil {
+		t.Fatalf("b.IsOwner = %v, %v, want true", ok, err)
+	}
+	if err := b.Unlock(ctx); err != nil {
+		t.Fatalf("b.Unlock err = %v", err)
+	}
+}
+
+func TestMutexNames(t *testing.T) {
+	ctx := context.Background()
+	child := NewMutex("test-mutex-name/child")
+	if err := child.Lock(ctx); err != nil {
+		t.Fatalf("child.Lock err = %v", err)
+	}
+	defer child.Unlock(ctx)
+
+	parent := NewMutex("test-mutex-name")
+	if err := parent.TryLock(ctx); err != nil {
+		t.Fatalf("parent.TryLock err = %v while only test-mutex-name/child is locked", err)
+	}
+	parent.Unlock(ctx)
+}
@@ -0,0 +1,203 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/liuyp5181/base/log"
+	"github.com/liuyp5181/base/signal"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const registerRetryInterval = time.Second
+
+// ErrRegistrationClosed is returned when a closed registration is updated
+var ErrRegistrationClosed = errors.New("etcd: registration closed")
+
+// Registration is a service instance registered by SetService
+type Registration struct {
+	sync.Mutex
+	svc     Service
+	leaseID clientv3.LeaseID
+	ttl     int64
+	cancel  context.CancelFunc
+	closed  bool
+}
+
+type RegisterOption func(*Registration)
+
+// WithOwnLease puts the key under a lease of ttl seconds owned by the registration, revoked by Close,
+// instead of the lease of the process. The key is registered again when the lease is lost
+func WithOwnLease(ttl int64) RegisterOption {
+	return func(r *Registration) {
+		r.ttl = ttl
+	}
+}
+
+// WithMetadata sets the metadata of the instance
+func WithMetadata(md map[string]string) RegisterOption {
+	return func(r *Registration) {
+		r.svc.Metadata = md
+	}
+}
+
+var (
+	regMu     sync.Mutex
+	regList   = make(map[*Registration]bool)
+	regSignal sync.Once
+)
+
+func addRegistration(r *Registration) {
+	regMu.Lock()
+	regList[r] = true
+	regMu.Unlock()
+
+	regSignal.Do(func() {
+		signal.RegisterClose(CloseServices)
+	})
+}
+
+// CloseServices removes every registration of the process and revokes the lease of the process,
+// it is called on shutdown
+func CloseServices() {
+	regMu.Lock()
+	var list = make([]*Registration, 0, len(regList))
+	for r := range regList {
+		list = append(list, r)
+	}
+	regMu.Unlock()
+
+	for _, r := range list {
+		ctx, cancel := requestContext()
+		if err := r.Close(ctx); err != nil {
+			log.Errorf("close service %s failed, err = %v", r.svc.Key, err)
+		}
+		cancel()
+	}
+
+	if serLeaseID != clientv3.NoLease {
+		ctx, cancel := requestContext()
+		if _, err := client.Revoke(ctx, serLeaseID); err != nil {
+			log.Errorf("revoke service lease failed, err = %v", err)
+		}
+		cancel()
+	}
+}
+
+// register puts the key, on a new lease when the registration owns its lease. Called with r locked or
+// before r is shared
+func (r *Registration) register(ctx context.Context) error {
+	if r.ttl > 0 {
+		lease, err := client.Grant(ctx, r.ttl)
+		if err != nil {
+			return fmt.Errorf("grant lease failed, err = %v", err)
+		}
+		r.leaseID = lease.ID
+		if err = r.put(ctx); err != nil {
+			client.Revoke(ctx, lease.ID)
+			return err
+		}
+		kctx, cancel := context.WithCancel(context.Background())
+		ch, err := client.KeepAlive(kctx, lease.ID)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("keep alive lease failed, err = %v", err)
+		}
+		r.cancel = cancel
+		go r.keepAlive(kctx, ch)
+		return nil
+	}
+	return r.put(ctx)
+}
+
+func (r *Registration) put(ctx context.Context) error {
+	val, err := json.Marshal(r.svc)
+	if err != nil {
+		return err
+	}
+	_, err = client.Put(ctx, r.svc.Key, string(val), clientv3.WithLease(r.leaseID)) //把服务的key绑定到租约下面
+	return err
+}
+
+// keepAlive registers the key again when the lease of the registration is lost
+func (r *Registration) keepAlive(ctx context.Context, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	for range ch {
+	}
+	for ctx.Err() == nil {
+		log.Warningf("service %s lease lost, register again", r.svc.Key)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(registerRetryInterval):
+		}
+
+		r.Lock()
+		if r.closed || ctx.Err() != nil {
+			r.Unlock()
+			return
+		}
+		rctx, cancel := requestContext()
+		stop := r.cancel
+		err := r.register(rctx)
+		cancel()
+		r.Unlock()
+		if err == nil {
+			stop()
+			return
+		}
+		log.Errorf("register service %s failed, err = %v", r.svc.Key, err)
+	}
+}
+
+// Service returns the registered instance
+func (r *Registration) Service() Service {
+	r.Lock()
+	defer r.Unlock()
+	return r.svc
+}
+
+// Update changes the registered instance with fn, e.g. its Power or Metadata. The key, name and
+// address of the instance can not be changed
+func (r *Registration) Update(ctx context.Context, fn func(s *Service)) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return ErrRegistrationClosed
+	}
+	svc := r.svc
+	fn(&svc)
+	svc.Key, svc.Name, svc.IP, svc.Port = r.svc.Key, r.svc.Name, r.svc.IP, r.svc.Port
+
+	old := r.svc
+	r.svc = svc
+	if err := r.put(ctx); err != nil {
+		r.svc = old
+		return err
+	}
+	return nil
+}
+
+// Close removes the instance from etcd and revokes its own lease
+func (r *Registration) Close(ctx context.Context) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	regMu.Lock()
+	delete(regList, r)
+	regMu.Unlock()
+
+	if r.cancel != nil {
+		r.cancel()
+		_, err := client.Revoke(ctx, r.leaseID)
+		return err
+	}
+	_, err := client.Delete(ctx, r.svc.Key)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -14,12 +15,13 @@ const (
 )
 
 type Service struct {
-	Key     string `json:"key"`
-	Name    string `json:"name"`
-	IP      string `json:"ip"`
-	Port    int    `json:"port"`
-	Version string `json:"version"`
-	Power   int    `json:"power"`
+	Key      string            `json:"key"`
+	Name     string            `json:"name"`
+	IP       string            `json:"ip"`
+	Port     int               `json:"port"`
+	Version  string            `json:"version"`
+	Power    int               `json:"power"`
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 var (
@@ -31,7 +33,9 @@ func initService() {
 	//设置租约过期时间为20秒
 	var ctx, cancle = context.WithCancel(context.Background())
 	serLease = clientv3.NewLease(client)
-	leaseRes, err := serLease.Grant(ctx, 20)
+	gctx, gcancel := requestContext()
+	leaseRes, err := serLease.Grant(gctx, 20)
+	gcancel()
 	if err != nil {
 		panic(err)
 	}
@@ -55,16 +59,37 @@ func initService() {
 	}()
 }
 
+// servicePrefix returns the prefix of the instances of name, of all the services when name is empty.
+// It ends with / so that foo does not match foobar
+func servicePrefix(name string) string {
+	if name == "" {
+		return serviceKey + "/"
+	}
+	return fmt.Sprintf("%s/%s/", serviceKey, name)
+}
+
+// ServiceNameFromKey returns the service name of an instance key services/<name>/<ip>:<port>, or ""
+func ServiceNameFromKey(key string) string {
+	rest := strings.TrimPrefix(key, serviceKey+"/")
+	i := strings.LastIndexByte(rest, '/')
+	if rest == key || i <= 0 {
+		return ""
+	}
+	return rest[:i]
+}
+
 // WatcherService 负责将监听到的put、delete请求存放到指定list
 func WatcherService(cancelCtx context.Context, name string) clientv3.WatchChan {
-	key := fmt.Sprintf("%s/%s", serviceKey, name)
+	key := servicePrefix(name)
 	watcher := clientv3.NewWatcher(client)
 	return watcher.Watch(cancelCtx, key, clientv3.WithPrefix())
 }
 
 func GetService(name string) ([]Service, error) {
-	key := fmt.Sprintf("%s/%s", serviceKey, name)
-	resp, err := client.Get(context.Background(), key, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	key := servicePrefix(name)
+	ctx, cancel := requestContext()
+	defer cancel()
+	resp, err := client.Get(ctx, key, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 	if err != nil {
 		return nil, err
 	}
@@ -82,31 +107,39 @@ func GetService(name string) ([]Service, error) {
 	return list, nil
 }
 
-func SetService(name string, ip string, port int, version string, power int) error {
+// SetService registers the service instance and returns the handle to update or remove it. The key is
+// put under the lease of the process unless WithOwnLease is given
+func SetService(name string, ip string, port int, version string, power int, opts ...RegisterOption) (*Registration, error) {
 	key := fmt.Sprintf("%s/%s/%s:%d", serviceKey, name, ip, port)
 
-	val, err := json.Marshal(Service{
-		Key:     key,
-		Name:    name,
-		IP:      ip,
-		Port:    port,
-		Version: version,
-		Power:   power,
-	})
-
-	kv := clientv3.NewKV(client)
-	ctx := context.Background()
-
-	_, err = kv.Put(ctx, key, string(val), clientv3.WithLease(serLeaseID)) //把服务的key绑定到租约下面
-	if err != nil {
-		return err
+	r := &Registration{
+		svc: Service{
+			Key:     key,
+			Name:    name,
+			IP:      ip,
+			Port:    port,
+			Version: version,
+			Power:   power,
+		},
+		leaseID: serLeaseID,
+	}
+	for _, o := range opts {
+		o(r)
 	}
 
-	return nil
+	ctx, cancel := requestContext()
+	defer cancel()
+	if err := r.register(ctx); err != nil {
+		return nil, err
+	}
+	addRegistration(r)
+	return r, nil
 }
 
 func PrintService() {
-	resp, err := client.Get(context.Background(), serviceKey, clientv3.WithPrefix())
+	ctx, cancel := requestContext()
+	defer cancel()
+	resp, err := client.Get(ctx, serviceKey, clientv3.WithPrefix())
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,19 @@
+package etcd
+
+import "testing"
+
+func TestServiceNameFromKey(t *testing.T) {
+	tests := map[string]string{
+		"services/order/10.0.0.1:8080":     "order",
+		"services/pkg.Order/10.0.0.1:8080": "pkg.Order",
+		"services/order/":                  "order",
+		"services/order":                   "",
+		"services/":                        "",
+		"locks/order/10.0.0.1:8080":        "",
+	}
+	for key, want := range tests {
+		if got := ServiceNameFromKey(key); got != want {
+			t.Errorf("ServiceNameFromKey(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/liuyp5181/base/log"
+	"github.com/liuyp5181/base/util"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const (
+	workerKey        = "workers"
+	defaultWorkerTTL = 10
+)
+
+// ErrNoWorkerID is returned when every worker id is leased by other processes
+var ErrNoWorkerID = errors.New("etcd: no worker id available")
+
+// WorkerID is a worker id leased from etcd, no other process holds the same id while the lease is alive.
+// The keys are workers/<id>, shared by all the services of the cluster
+type WorkerID struct {
+	sync.Mutex
+	id      int64
+	ttl     int
+	session *concurrency.Session
+	cancel  context.CancelFunc
+}
+
+type WorkerOption func(*WorkerID)
+
+// WithWorkerTTL sets the lease TTL in seconds, the id is free again this long after the holder dies, 10 by default
+func WithWorkerTTL(ttl int) WorkerOption {
+	return func(w *WorkerID) {
+		w.ttl = ttl
+	}
+}
+
+// AcquireWorkerID leases a free worker id in [0, util.MaxWorkerID]
+func AcquireWorkerID(ctx context.Context, opts ...WorkerOption) (*WorkerID, error) {
+	w := &WorkerID{ttl: defaultWorkerTTL}
+	for _, o := range opts {
+		o(w)
+	}
+	if err := w.acquire(ctx, rand.Int63n(util.MaxWorkerID+1)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// acquire tries the ids from start on, the first free one is taken with a create-only txn
+func (w *WorkerID) acquire(ctx context.Context, start int64) error {
+	session, err := concurrency.NewSession(client, concurrency.WithTTL(w.ttl))
+	if err != nil {
+		return fmt.Errorf("create session failed, err = %v", err)
+	}
+	host, _ := os.Hostname()
+	value := fmt.Sprintf("%s:%d", host, os.Getpid())
+	for i := int64(0); i <= util.MaxWorkerID; i++ {
+		id := (start + i) % (util.MaxWorkerID + 1)
+		key := workerKey + "/" + strconv.FormatInt(id, 10)
+		resp, err := client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, value, clientv3.WithLease(session.Lease()))).
+			Commit()
+		if err != nil {
+			session.Close()
+			return fmt.Errorf("lease worker id failed, err = %v", err)
+		}
+		if resp.Succeeded {
+			w.id = id
+			w.session = session
+			return nil
+		}
+	}
+	session.Close()
+	return ErrNoWorkerID
+}
+
+// ID returns the leased worker id
+func (w *WorkerID) ID() int64 {
+	w.Lock()
+	defer w.Unlock()
+	return w.id
+}
+
+// Done is closed when the lease is lost, the id may then be taken by another process
+func (w *WorkerID) Done() <-chan struct{} {
+	w.Lock()
+	defer w.Unlock()
+	return w.session.Done()
+}
+
+// Close stops renewing the id and releases it, util.NextID fails afterwards when it is the id set by
+// RegisterWorkerID
+func (w *WorkerID) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+	if w == workerID {
+		// another process may take the id as soon as it is released
+		util.ClearWorkerID()
+	}
+	return w.session.Close()
+}
+
+var (
+	workerOnce sync.Once
+	workerID   *WorkerID
+	workerErr  error
+)
+
+// RegisterWorkerID leases a worker id once per process and sets it as the worker id of util.NextID.
+// When the lease is lost util.NextID fails until the id is leased again, the same id is tried first
+// and the nearest free one is taken otherwise
+func RegisterWorkerID(opts ...WorkerOption) (*WorkerID, error) {
+	workerOnce.Do(func() {
+		ctx, cancel := requestContext()
+		defer cancel()
+		w, err := AcquireWorkerID(ctx, opts...)
+		if err != nil {
+			workerErr = err
+			return
+		}
+		if err = util.SetWorkerID(w.id); err != nil {
+			w.session.Close()
+			workerErr = err
+			return
+		}
+		log.Infof("worker id %d leased", w.id)
+
+		kctx, kcancel := context.WithCancel(context.Background())
+		w.cancel = kcancel
+		go w.keep(kctx)
+		workerID = w
+	})
+	return workerID, workerErr
+}
+
+func (w *WorkerID) keep(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.Done():
+		}
+		// another process may take the id once the lease expired, stop issuing ids until it is leased again
+		util.ClearWorkerID()
+		log.Warningf("worker id %d lease lost, lease again", w.ID())
+		for ctx.Err() == nil {
+			w.Lock()
+			if ctx.Err() != nil {
+				w.Unlock()
+				return
+			}
+			actx, cancel := requestContext()
+			err := w.acquire(actx, w.id)
+			cancel()
+			id := w.id
+			if err == nil {
+				// set under the lock so that a concurrent Close clears it after
+				util.SetWorkerID(id)
+			}
+			w.Unlock()
+			if err == nil {
+				log.Infof("worker id %d leased", id)
+				break
+			}
+			log.Errorf("lease worker id failed, err = %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(registerRetryInterval):
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/liuyp5181/base/util"
+)
+
+func TestRegisterWorkerIDClose(t *testing.T) {
+	w, err := RegisterWorkerID(WithWorkerTTL(5))
+	if err != nil {
+		t.Fatalf("RegisterWorkerID err = %v", err)
+	}
+	if _, err = util.NextID(); err != nil {
+		t.Fatalf("NextID err = %v while the worker id is leased", err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close err = %v", err)
+	}
+	if id, err := util.NextID(); err != util.ErrWorkerNotSet {
+		t.Fatalf("NextID = %d, %v after Close, want ErrWorkerNotSet", id, err)
+	}
+
+	// the released id is free for another process
+	ctx, cancel := requestContext()
+	defer cancel()
+	other := &WorkerID{ttl: defaultWorkerTTL}
+	if err = other.acquire(ctx, w.ID()); err != nil {
+		t.Fatalf("acquire err = %v", err)
+	}
+	defer other.Close()
+	if other.ID() != w.ID() {
+		t.Fatalf("acquired worker id %d, want the released id %d", other.ID(), w.ID())
+	}
+}
+
+func TestAcquireWorkerID(t *testing.T) {
+	a, err := AcquireWorkerID(context.Background())
+	if err != nil {
+		t.Fatalf("AcquireWorkerID err = %v", err)
+	}
+	defer a.Close()
+	b, err := AcquireWorkerID(context.Background())
+	if err != nil {
+		t.Fatalf("AcquireWorkerID err = %v", err)
+	}
+	defer b.Close()
+	if a.ID() == b.ID() {
+		t.Fatalf("two leases of the worker id %d", a.ID())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,9 +40,9 @@ var logName = map[int]string{
 type Config struct {
 	Path    string `mapstructure:"path"`
 	Name    string `mapstructure:"name"`
-	Level   int    `mapstructure:"level"`
-	MaxSize int64  `mapstructure:"max_size"`
-	MaxAge  int    `mapstructure:"max_age"`
+	Level   int    `mapstructure:"level" validate:"min=0,max=4"`
+	MaxSize int64  `mapstructure:"max_size" validate:"min=0"`
+	MaxAge  int    `mapstructure:"max_age" validate:"min=0"`
 }
 
 type Logger struct {
@@ -52,6 +53,7 @@ type Logger struct {
 	wg       sync.WaitGroup
 	currTime string
 	mode     int
+	level    atomic.Int32
 }
 
 var logger Logger
@@ -65,6 +67,7 @@ func init() {
 		MaxSize: 0,
 		MaxAge:  0,
 	}
+	logger.level.Store(debugLv)
 	logger.f = os.Stderr
 	logger.mode = consoleMode
 	go watch()
@@ -78,6 +81,7 @@ func init() {
 func Init(cfg *Config) error {
 	cfg.MaxSize *= 1024 * 1024
 	logger.cfg = cfg
+	logger.level.Store(int32(cfg.Level))
 	if len(cfg.Name) == 0 {
 		cfg.Name = fileName
 	}
@@ -99,6 +103,11 @@ func Init(cfg *Config) error {
 	return nil
 }
 
+// SetLevel changes the lowest level written, it is safe to call while logging
+func SetLevel(level int) {
+	logger.level.Store(int32(level))
+}
+
 func isNewFile() bool {
 	if logger.f == nil {
 		return true
@@ -206,14 +215,14 @@ func header(lv int) string {
 }
 
 func output(lv int, args ...interface{}) {
-	if lv < logger.cfg.Level {
+	if int32(lv) < logger.level.Load() {
 		return
 	}
 	logger.ch <- header(lv) + fmt.Sprintln(args...)
 }
 
 func outputf(lv int, format string, args ...interface{}) {
-	if lv < logger.cfg.Level {
+	if int32(lv) < logger.level.Load() {
 		return
 	}
 	logger.ch <- header(lv) + fmt.Sprintf(format, args...) + "\n"
@@ -1,8 +1,13 @@
 package mq
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/Shopify/sarama"
+	"github.com/liuyp5181/base/service/extend"
+	"github.com/liuyp5181/base/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
@@ -50,19 +55,38 @@ func ConnectKafka(name string, adders []string) error {
 }
 
 func Publish(name, topic string, msg interface{}) error {
+	return PublishContext(context.Background(), name, topic, msg)
+}
+
+// PublishContext publishes msg with the trace context and baggage of ctx in the record headers
+func PublishContext(ctx context.Context, name, topic string, msg interface{}) error {
 	kf := kafkaList[name]
 
 	data, _ := json.Marshal(msg)
-	_, _, err := kf.producer.SendMessage(&sarama.ProducerMessage{
+	pm := &sarama.ProducerMessage{
 		Topic: topic,
 		Key:   nil,
 		Value: sarama.StringEncoder(data),
-	})
+	}
+	ctx, span := tracing.Start(ctx, topic+" publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", topic),
+	))
+	extend.Inject(ctx, producerCarrier{pm})
+	_, _, err := kf.producer.SendMessage(pm)
+	tracing.End(span, err)
 
 	return err
 }
 
 func Subscribe(name, topic string, f func(key string, val []byte)) error {
+	return SubscribeContext(name, topic, func(ctx context.Context, key string, val []byte) {
+		f(key, val)
+	})
+}
+
+// SubscribeContext calls f with a context continuing the trace and baggage of the record headers
+func SubscribeContext(name, topic string, f func(ctx context.Context, key string, val []byte)) error {
 	kf := kafkaList[name]
 	consumer := kf.consumer
 
@@ -78,10 +102,66 @@ func Subscribe(name, topic string, f func(key string, val []byte)) error {
 
 		go func(_cp sarama.PartitionConsumer) {
 			for msg := range _cp.Messages() {
-				f(string(msg.Key), msg.Value)
+				ctx, span := tracing.Start(extend.Extract(context.Background(), consumerCarrier{msg}), topic+" receive",
+					trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+						attribute.String("messaging.system", "kafka"),
+						attribute.String("messaging.source.name", topic),
+						attribute.Int64("messaging.kafka.source.partition", int64(msg.Partition)),
+						attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+					))
+				f(ctx, string(msg.Key), msg.Value)
+				span.End()
 			}
 		}(cp)
 	}
 
 	return nil
 }
+
+// producerCarrier writes extend headers to a record
+type producerCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c producerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c producerCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// consumerCarrier reads extend headers from a consumed record
+type consumerCarrier struct {
+	msg *sarama.ConsumerMessage
+}
+
+func (c consumerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c consumerCarrier) Set(key, value string) {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			h.Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/liuyp5181/base/log"
 	"github.com/liuyp5181/base/service/extend"
 	"github.com/liuyp5181/base/service/proxy"
-	"github.com/liuyp5181/base/util"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	_ "google.golang.org/grpc/health"
@@ -16,46 +16,78 @@ import (
 )
 
 type Client struct {
-	Server     *etcd.Service
-	Conn       *grpc.ClientConn
-	proxy      *proxy.Proxy
-	cancelFunc context.CancelFunc
+	Server *etcd.Service
+	Conn   *grpc.ClientConn
+	proxy  *proxy.Proxy
 }
 
 // unaryClientInterceptor 拦截器，相对于中间件
 func unaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-	e := extend.NewContext(ctx)
-	var tid string
+	ctx, span, tid, uid := outgoingContext(ctx, method)
+
+	log.Infof("request  [%s] %s %s data: %+v", tid, uid, method, req)
+
+	// 服务端返回的 header/trailer 写入调用方的 Extend
+	if e, ok := extend.FromContext(ctx); ok {
+		initMetadata(e)
+		opts = append(opts, grpc.Header(e.MD), grpc.Trailer(e.Trailer))
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	endRPCSpan(span, err)
+	if err != nil {
+		log.Errorf("invoker  [%s] %s %s err: %v", tid, uid, method, err)
+		return err
+	}
+
+	log.Infof("response [%s] %s %s data: %+v", tid, uid, method, reply)
+	return nil
+}
+
+func streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, span, tid, uid := outgoingContext(ctx, method)
+
+	log.Infof("stream   [%s] %s %s", tid, uid, method)
+
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		endRPCSpan(span, err)
+		log.Errorf("streamer [%s] %s %s err: %v", tid, uid, method, err)
+		return nil, err
+	}
+	e, _ := extend.FromContext(ctx)
+	if e != nil {
+		initMetadata(e)
+	}
+	return newClientStream(ctx, cs, desc, span, e), nil
+}
+
+func initMetadata(e *extend.Extend) {
+	if e.MD == nil {
+		e.MD = &metadata.MD{}
+	}
+	if e.Trailer == nil {
+		e.Trailer = &metadata.MD{}
+	}
+}
+
+// outgoingContext starts the span of the call and propagates it with the baggage and user_id of ctx
+// to the outgoing metadata
+func outgoingContext(ctx context.Context, method string) (context.Context, trace.Span, string, string) {
+	ctx, span := startRPCSpan(extend.ExtractOutgoing(ctx), method, trace.SpanKindClient)
+	ctx = extend.InjectOutgoing(ctx)
 	var uid string
 	md, ok := metadata.FromOutgoingContext(ctx)
 	if ok {
-		ss := md.Get("trace_id")
-		if len(ss) > 0 {
-			tid = ss[0]
-		}
-		ss = md.Get("user_id")
+		ss := md.Get("user_id")
 		if len(ss) > 0 {
 			uid = ss[0]
 		}
 	}
-	if tid == "" {
-		tid = util.GenerateId("trace_id", req)
-		e.SetClient("trace_id", tid)
-	}
 	if uid == "" {
 		uid = config.ServiceName
-		e.SetClient("user_id", uid)
+		ctx = metadata.AppendToOutgoingContext(ctx, "user_id", uid)
 	}
-
-	log.Infof("request  [%s] %s %s data: %+v", tid, uid, method, req)
-
-	if err := invoker(e.Ctx, method, req, reply, cc, opts...); err != nil {
-		log.Errorf("invoker  [%s] %s %s err: %v", tid, uid, method, err)
-		return err
-	}
-
-	log.Infof("response [%s] %s %s data: %+v", tid, uid, method, reply)
-	return nil
+	return ctx, span, extend.TraceID(ctx), uid
 }
 
 func newClient(s *etcd.Service) (*Client, error) {
@@ -63,7 +95,8 @@ func newClient(s *etcd.Service) (*Client, error) {
 	conn, err := grpc.Dial(fmt.Sprintf("%s:%d", s.IP, s.Port),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"HealthCheckConfig": {"ServiceName": "%s"}}`, HEALTHCHECK_SERVICE)),
-		grpc.WithUnaryInterceptor(unaryClientInterceptor))
+		grpc.WithUnaryInterceptor(unaryClientInterceptor),
+		grpc.WithStreamInterceptor(streamClientInterceptor))
 	if err != nil {
 		return nil, fmt.Errorf("dial err = %v", err)
 	}
@@ -88,11 +121,19 @@ func (c *Client) Proxy(ctx context.Context, methodName string, message []byte, o
 	return rsp, nil
 }
 
+// ProxyInvoke calls methodName with md as request metadata and returns the response together with the
+// headers, trailers and status sent back by the server
+func (c *Client) ProxyInvoke(ctx context.Context, methodName string, message []byte, md metadata.MD, opts ...grpc.CallOption) (*proxy.Result, error) {
+	return c.proxy.Invoke(ctx, c.Server.Name, methodName, message, md, opts...)
+}
+
+// GetProxy returns the reflection based proxy of the connection
+func (c *Client) GetProxy() *proxy.Proxy {
+	return c.proxy
+}
+
 func (c *Client) close() {
 	if c.Conn != nil {
 		c.Conn.Close()
 	}
-	if c.cancelFunc != nil {
-		c.cancelFunc()
-	}
 }
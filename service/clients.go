@@ -15,13 +15,15 @@ import (
 
 type Clients struct {
 	sync.RWMutex
-	list map[string][]*Client
-	m    map[string]*Client
+	list   map[string][]*Client
+	m      map[string]*Client
+	cancel map[string]context.CancelFunc
 }
 
 var clients = &Clients{
-	list: map[string][]*Client{},
-	m:    map[string]*Client{},
+	list:   map[string][]*Client{},
+	m:      map[string]*Client{},
+	cancel: map[string]context.CancelFunc{},
 }
 
 func (cs *Clients) isExist(name string) bool {
@@ -36,7 +38,7 @@ func (cs *Clients) isExist(name string) bool {
 func (cs *Clients) setCancel(name string, cancelFunc context.CancelFunc) {
 	cs.Lock()
 	defer cs.Unlock()
-	cs.m[name].cancelFunc = cancelFunc
+	cs.cancel[name] = cancelFunc
 }
 
 func (cs *Clients) setClient(key string, c *Client) {
@@ -82,6 +84,10 @@ func (cs *Clients) closeClients(name string) {
 		c.close()
 	}
 	clients.list[name] = nil
+	if cancel, ok := clients.cancel[name]; ok {
+		cancel()
+		delete(clients.cancel, name)
+	}
 }
 
 func initClient(name string) error {
@@ -151,7 +157,7 @@ func PrintClient() {
 }
 
 func setClient(key string, s etcd.Service) error {
-	if s.Name == config.ServiceName && s.IP == config.GetConfig().Server.IP && s.Port == config.GetConfig().Server.Port {
+	if s.Name == config.ServiceName && s.IP == config.Get().Server.IP && s.Port == config.Get().Server.Port {
 		return nil
 	}
 
@@ -0,0 +1,208 @@
+package extend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// MaxBaggageMembers, MaxBaggageBytes and MaxBaggageMemberBytes are the W3C baggage limits
+	MaxBaggageMembers     = 64
+	MaxBaggageBytes       = 8192
+	MaxBaggageMemberBytes = 4096
+)
+
+// ErrBaggageLimit is returned when a member does not fit in the baggage
+var ErrBaggageLimit = errors.New("baggage limit exceeded")
+
+// Baggage is the W3C baggage propagated with the trace, a Baggage value is never modified in place
+type Baggage struct {
+	members []member
+}
+
+type member struct {
+	key   string
+	value string
+	// props are the member properties, passed on unchanged
+	props string
+}
+
+type baggageKey struct{}
+
+// ParseBaggage parses a baggage header value. Invalid members and members over the limits are dropped,
+// the returned error reports them while the baggage holds the valid ones
+func ParseBaggage(s string) (Baggage, error) {
+	var b Baggage
+	var errs []string
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		var props string
+		if i := strings.IndexByte(m, ';'); i >= 0 {
+			m, props = m[:i], strings.TrimSpace(m[i+1:])
+		}
+		i := strings.IndexByte(m, '=')
+		if i < 0 {
+			errs = append(errs, fmt.Sprintf("invalid member %q", m))
+			continue
+		}
+		key := strings.TrimSpace(m[:i])
+		value, err := url.PathUnescape(strings.TrimSpace(m[i+1:]))
+		if err != nil || !isToken(key) {
+			errs = append(errs, fmt.Sprintf("invalid member %q", m))
+			continue
+		}
+		nb, err := b.set(member{key: key, value: value, props: props})
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		b = nb
+	}
+	if len(errs) > 0 {
+		return b, fmt.Errorf("parse baggage failed, %s", strings.Join(errs, "; "))
+	}
+	return b, nil
+}
+
+// Get returns the value of key
+func (b Baggage) Get(key string) (string, bool) {
+	for _, m := range b.members {
+		if m.key == key {
+			return m.value, true
+		}
+	}
+	return "", false
+}
+
+// Set returns a copy of b with key set to value, it fails when the key is not a valid token or the
+// result would exceed the limits
+func (b Baggage) Set(key, value string) (Baggage, error) {
+	if !isToken(key) {
+		return b, fmt.Errorf("invalid baggage key %q", key)
+	}
+	return b.set(member{key: key, value: value})
+}
+
+func (b Baggage) set(m member) (Baggage, error) {
+	if n := len(m.encode()); n > MaxBaggageMemberBytes {
+		return b, fmt.Errorf("%w, member %s is %d bytes", ErrBaggageLimit, m.key, n)
+	}
+	var nb = Baggage{members: make([]member, 0, len(b.members)+1)}
+	for _, o := range b.members {
+		if o.key != m.key {
+			nb.members = append(nb.members, o)
+		}
+	}
+	nb.members = append(nb.members, m)
+	if len(nb.members) > MaxBaggageMembers {
+		return b, fmt.Errorf("%w, more than %d members", ErrBaggageLimit, MaxBaggageMembers)
+	}
+	if n := len(nb.String()); n > MaxBaggageBytes {
+		return b, fmt.Errorf("%w, baggage is %d bytes", ErrBaggageLimit, n)
+	}
+	return nb, nil
+}
+
+// Delete returns a copy of b without key
+func (b Baggage) Delete(key string) Baggage {
+	var nb Baggage
+	for _, m := range b.members {
+		if m.key != key {
+			nb.members = append(nb.members, m)
+		}
+	}
+	return nb
+}
+
+func (b Baggage) Len() int {
+	return len(b.members)
+}
+
+// Members returns the key value pairs of b
+func (b Baggage) Members() map[string]string {
+	var res = make(map[string]string, len(b.members))
+	for _, m := range b.members {
+		res[m.key] = m.value
+	}
+	return res
+}
+
+// String returns the baggage header value
+func (b Baggage) String() string {
+	var list = make([]string, 0, len(b.members))
+	for _, m := range b.members {
+		list = append(list, m.encode())
+	}
+	return strings.Join(list, ",")
+}
+
+func (m member) encode() string {
+	s := m.key + "=" + encodeBaggageValue(m.value)
+	if m.props != "" {
+		s += ";" + m.props
+	}
+	return s
+}
+
+// WithBaggage returns a copy of ctx carrying b
+func WithBaggage(ctx context.Context, b Baggage) context.Context {
+	return context.WithValue(ctx, baggageKey{}, b)
+}
+
+// BaggageFromContext returns the baggage carried by ctx
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageKey{}).(Baggage)
+	return b
+}
+
+// SetBaggage returns a copy of ctx whose baggage has key set to value
+func SetBaggage(ctx context.Context, key, value string) (context.Context, error) {
+	b, err := BaggageFromContext(ctx).Set(key, value)
+	if err != nil {
+		return ctx, err
+	}
+	return WithBaggage(ctx, b), nil
+}
+
+// GetBaggage returns the baggage value of key carried by ctx
+func GetBaggage(ctx context.Context, key string) string {
+	v, _ := BaggageFromContext(ctx).Get(key)
+	return v
+}
+
+// encodeBaggageValue percent-encodes the characters that are not allowed in a baggage value
+func encodeBaggageValue(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c > 0x20 && c < 0x7f && c != '"' && c != ',' && c != ';' && c != '\\' && c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+// isToken reports whether s is an RFC 7230 token
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -6,23 +6,34 @@ import (
 	"google.golang.org/grpc/metadata"
 )
 
+// Extend carries the metadata of a call. On the client, the headers and trailers sent back by the
+// server are stored in MD and Trailer by the client interceptors when the call is made with e.Ctx,
+// so an Extend must not be shared by concurrent calls
 type Extend struct {
-	Ctx context.Context
-	MD  *metadata.MD
+	Ctx     context.Context
+	MD      *metadata.MD
+	Trailer *metadata.MD
 }
 
+type extendKey struct{}
+
 func New() *Extend {
-	return &Extend{
-		Ctx: context.Background(),
-		MD:  &metadata.MD{},
-	}
+	return NewContext(context.Background())
 }
 
 func NewContext(ctx context.Context) *Extend {
-	return &Extend{
-		Ctx: ctx,
-		MD:  &metadata.MD{},
+	e := &Extend{
+		MD:      &metadata.MD{},
+		Trailer: &metadata.MD{},
 	}
+	e.Ctx = context.WithValue(ctx, extendKey{}, e)
+	return e
+}
+
+// FromContext returns the Extend whose Ctx ctx derives from
+func FromContext(ctx context.Context) (*Extend, bool) {
+	e, ok := ctx.Value(extendKey{}).(*Extend)
+	return e, ok
 }
 
 func (e *Extend) SetClient(key, val string) {
@@ -40,18 +51,71 @@ func (e *Extend) GetClient(key string) string {
 	return md[key][0]
 }
 
+// SetServer sends key in the response headers, same as SetHeader
 func (e *Extend) SetServer(key, val string) {
 	grpc.SetHeader(e.Ctx, metadata.MD{key: {val}})
 }
 
+// LoadServer returns the CallOption storing the response headers in e.MD, it is only needed when the
+// call is not made with e.Ctx
 func (e *Extend) LoadServer() grpc.CallOption {
 	return grpc.Header(e.MD)
 }
 
+// GetServer returns the response header key, same as GetHeader
 func (e *Extend) GetServer(key string) string {
-	v := e.MD.Get(key)
+	return e.GetHeader(key)
+}
+
+// SetHeader sends key in the response headers, the headers are sent with the first response message
+// of a unary or stream call, or with the status when there is none
+func (e *Extend) SetHeader(key string, vals ...string) error {
+	return grpc.SetHeader(e.Ctx, metadata.MD{key: vals})
+}
+
+// SetTrailer sends key in the response trailers, sent with the status when the call ends
+func (e *Extend) SetTrailer(key string, vals ...string) error {
+	return grpc.SetTrailer(e.Ctx, metadata.MD{key: vals})
+}
+
+// GetHeader returns the first value of the response header key
+func (e *Extend) GetHeader(key string) string {
+	return first(e.MD, key)
+}
+
+// GetTrailer returns the first value of the response trailer key, trailers of a stream are
+// available once the stream has ended
+func (e *Extend) GetTrailer(key string) string {
+	return first(e.Trailer, key)
+}
+
+func first(md *metadata.MD, key string) string {
+	if md == nil {
+		return ""
+	}
+	v := md.Get(key)
 	if len(v) == 0 {
 		return ""
 	}
 	return v[0]
 }
+
+// TraceID returns the hex trace id for log lines
+func (e *Extend) TraceID() string {
+	return TraceID(e.Ctx)
+}
+
+// SetBaggage sets key in the baggage propagated to the services called with e.Ctx
+func (e *Extend) SetBaggage(key, val string) error {
+	ctx, err := SetBaggage(e.Ctx, key, val)
+	if err != nil {
+		return err
+	}
+	e.Ctx = ctx
+	return nil
+}
+
+// GetBaggage returns the baggage value of key
+func (e *Extend) GetBaggage(key string) string {
+	return GetBaggage(e.Ctx, key)
+}
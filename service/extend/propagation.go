@@ -0,0 +1,114 @@
+package extend
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Carrier is a set of headers the trace context and baggage are written to and read from
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// MetadataCarrier adapts gRPC metadata
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	return strings.Join(metadata.MD(c).Get(key), ",")
+}
+
+func (c MetadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// HeaderCarrier adapts HTTP headers
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string {
+	return strings.Join(http.Header(c).Values(key), ",")
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	http.Header(c).Set(key, value)
+}
+
+// Inject writes the trace context and the baggage of ctx to c
+func Inject(ctx context.Context, c Carrier) {
+	if t, ok := TraceFromContext(ctx); ok {
+		c.Set(TraceparentKey, t.Traceparent())
+		if t.State != "" {
+			c.Set(TracestateKey, t.State)
+		}
+		c.Set(TraceIDKey, t.TraceIDString())
+	}
+	if b := BaggageFromContext(ctx); b.Len() > 0 {
+		c.Set(BaggageKey, b.String())
+	}
+}
+
+// Extract returns a copy of ctx carrying the trace context and the baggage read from c,
+// invalid values are ignored
+func Extract(ctx context.Context, c Carrier) context.Context {
+	if tp := c.Get(TraceparentKey); tp != "" {
+		if t, err := ParseTraceparent(tp, c.Get(TracestateKey)); err == nil {
+			ctx = WithTrace(ctx, t)
+		}
+	}
+	if s := c.Get(BaggageKey); s != "" {
+		b, _ := ParseBaggage(s)
+		if b.Len() > 0 {
+			ctx = WithBaggage(ctx, b)
+		}
+	}
+	return ctx
+}
+
+// ExtractIncoming returns a copy of ctx carrying the trace context and baggage of the incoming gRPC metadata
+func ExtractIncoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return Extract(ctx, MetadataCarrier(md))
+}
+
+// ExtractOutgoing returns a copy of ctx carrying the trace context and baggage the caller put in the
+// outgoing gRPC metadata, when ctx carries none
+func ExtractOutgoing(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	caller := Extract(context.Background(), MetadataCarrier(md))
+	if _, ok = TraceFromContext(ctx); !ok {
+		if t, ok := TraceFromContext(caller); ok {
+			ctx = WithTrace(ctx, t)
+		}
+	}
+	if BaggageFromContext(ctx).Len() == 0 {
+		ctx = WithBaggage(ctx, BaggageFromContext(caller))
+	}
+	return ctx
+}
+
+// InjectOutgoing returns a copy of ctx whose outgoing gRPC metadata carries the trace context and baggage of ctx
+func InjectOutgoing(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	Inject(ctx, MetadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// ExtractHTTP returns a copy of ctx carrying the trace context and baggage of the request headers
+func ExtractHTTP(ctx context.Context, h http.Header) context.Context {
+	return Extract(ctx, HeaderCarrier(h))
+}
+
+// InjectHTTP writes the trace context and baggage of ctx to the request headers
+func InjectHTTP(ctx context.Context, h http.Header) {
+	Inject(ctx, HeaderCarrier(h))
+}
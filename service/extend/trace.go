@@ -0,0 +1,161 @@
+package extend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/liuyp5181/base/util"
+)
+
+const (
+	// TraceparentKey, TracestateKey and BaggageKey are the W3C header names, also used as metadata keys
+	TraceparentKey = "traceparent"
+	TracestateKey  = "tracestate"
+	BaggageKey     = "baggage"
+	// TraceIDKey carries the hex trace id for services that only log trace_id
+	TraceIDKey = "trace_id"
+
+	traceparentVersion = "00"
+	flagSampled        = 0x01
+)
+
+// TraceContext is the W3C trace context of the current span
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	// State is the vendor specific tracestate, passed on unchanged
+	State string
+}
+
+type traceKey struct{}
+
+// NewTraceContext starts a new sampled trace. The trace id starts with a Snowflake id so that trace
+// ids are unique in the cluster and ordered by time, the rest is random
+func NewTraceContext() TraceContext {
+	var t = TraceContext{Flags: flagSampled}
+	randomBytes(t.TraceID[:])
+	if id, err := util.NextID(); err == nil {
+		binary.BigEndian.PutUint64(t.TraceID[:8], uint64(id))
+	}
+	randomBytes(t.SpanID[:])
+	return t
+}
+
+// ParseTraceparent parses the traceparent and tracestate header values
+func ParseTraceparent(traceparent, tracestate string) (TraceContext, error) {
+	var t TraceContext
+	s := strings.TrimSpace(traceparent)
+	if len(s) < 55 {
+		return t, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	version := s[:2]
+	if !isLowerHex(version) || version == "ff" {
+		return t, fmt.Errorf("invalid traceparent version %q", version)
+	}
+	// future versions may append fields, version 00 must not
+	if (version == traceparentVersion && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return t, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return t, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	traceID, spanID, flags := s[3:35], s[36:52], s[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return t, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	hex.Decode(t.TraceID[:], []byte(traceID))
+	hex.Decode(t.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	t.Flags = f[0]
+	if !t.IsValid() {
+		return TraceContext{}, fmt.Errorf("invalid traceparent %q, all zero id", traceparent)
+	}
+	t.State = strings.TrimSpace(tracestate)
+	return t, nil
+}
+
+// IsValid reports whether both the trace id and the span id are set
+func (t TraceContext) IsValid() bool {
+	return t.TraceID != [16]byte{} && t.SpanID != [8]byte{}
+}
+
+// IsSampled reports whether the caller records the trace
+func (t TraceContext) IsSampled() bool {
+	return t.Flags&flagSampled != 0
+}
+
+// Child returns the trace context of a new span in the same trace
+func (t TraceContext) Child() TraceContext {
+	c := t
+	randomBytes(c.SpanID[:])
+	return c
+}
+
+// Traceparent returns the traceparent header value
+func (t TraceContext) Traceparent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, t.TraceIDString(), t.SpanIDString(), t.Flags)
+}
+
+func (t TraceContext) TraceIDString() string {
+	return hex.EncodeToString(t.TraceID[:])
+}
+
+func (t TraceContext) SpanIDString() string {
+	return hex.EncodeToString(t.SpanID[:])
+}
+
+// WithTrace returns a copy of ctx carrying t
+func WithTrace(ctx context.Context, t TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// TraceFromContext returns the trace context carried by ctx
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	t, ok := ctx.Value(traceKey{}).(TraceContext)
+	return t, ok && t.IsValid()
+}
+
+// StartSpan returns a copy of ctx carrying a new span of its trace, or of a new trace when ctx has none
+func StartSpan(ctx context.Context) context.Context {
+	if t, ok := TraceFromContext(ctx); ok {
+		return WithTrace(ctx, t.Child())
+	}
+	return WithTrace(ctx, NewTraceContext())
+}
+
+// TraceID returns the hex trace id of ctx for log lines, or "" when ctx has no trace
+func TraceID(ctx context.Context) string {
+	if t, ok := TraceFromContext(ctx); ok {
+		return t.TraceIDString()
+	}
+	return ""
+}
+
+func randomBytes(b []byte) {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Sprintf("read random failed, err = %v", err))
+		}
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
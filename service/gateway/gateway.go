@@ -0,0 +1,528 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/liuyp5181/base/etcd"
+	"github.com/liuyp5181/base/log"
+	"github.com/liuyp5181/base/service"
+	"github.com/liuyp5181/base/service/extend"
+	"github.com/liuyp5181/base/service/proxy"
+	"github.com/liuyp5181/base/service/schema"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// retryInterval is the period of the retries of the services whose routes could not be loaded
+	retryInterval  = 5 * time.Second
+	resolveTimeout = 10 * time.Second
+	// defaultMaxBodySize limits the request bodies, see WithMaxBodySize
+	defaultMaxBodySize = 4 << 20
+
+	// MetadataHeaderPrefix marks request headers forwarded as metadata and response headers carrying metadata
+	MetadataHeaderPrefix = "Grpc-Metadata-"
+	// TrailerHeaderPrefix marks response headers carrying trailer metadata
+	TrailerHeaderPrefix = "Grpc-Trailer-"
+)
+
+// errMethodNotAllowed is returned by defaultRoute for the methods of /<service>/<method> other than POST
+var errMethodNotAllowed = errors.New("method not allowed")
+
+var defaultForwardHeaders = []string{
+	"authorization",
+	"traceparent",
+	"tracestate",
+	"baggage",
+	"x-request-id",
+	"trace_id",
+	"user_id",
+}
+
+// Gateway exposes the gRPC services discovered in etcd as HTTP/JSON endpoints.
+// Every method is served on POST /<service>/<method>, methods annotated with google.api.http are
+// also served on their own routes, and server streaming methods answer with server-sent events.
+// The OpenAPI document of each service and the JSON Schema of each message are served on
+// GET /openapi/<service>.json and GET /schema/<message>.json, unless an annotated route matches
+type Gateway struct {
+	sync.RWMutex
+	routes  map[string][]*route
+	ordered []*route
+	pending map[string]bool
+	headers []string
+	marshal []grpc.CallOption
+	opts    proxy.MarshalOptions
+	maxBody int64
+	schema  http.Handler
+	cancel  context.CancelFunc
+}
+
+type Option func(*Gateway)
+
+// WithForwardHeaders replaces the request headers forwarded to the backend as metadata
+func WithForwardHeaders(headers ...string) Option {
+	return func(g *Gateway) {
+		g.headers = headers
+	}
+}
+
+// WithMarshalOptions sets the JSON mapping of the responses
+func WithMarshalOptions(o proxy.MarshalOptions) Option {
+	return func(g *Gateway) {
+		g.opts = o
+		g.marshal = []grpc.CallOption{proxy.CallMarshalOptions(o)}
+	}
+}
+
+// WithMaxBodySize sets the largest request body in bytes, larger ones are answered with 413. 4 MiB by
+// default, no limit when n <= 0
+func WithMaxBodySize(n int64) Option {
+	return func(g *Gateway) {
+		g.maxBody = n
+	}
+}
+
+func New(opts ...Option) *Gateway {
+	g := &Gateway{
+		routes:  map[string][]*route{},
+		pending: map[string]bool{},
+		headers: defaultForwardHeaders,
+		maxBody: defaultMaxBodySize,
+	}
+	for _, o := range opts {
+		o(g)
+	}
+	g.schema = schema.NewHandlerWithOptions(g, g.opts)
+	return g
+}
+
+// Start connects to every service registered in etcd and keeps the annotation routes up to date
+func (g *Gateway) Start() error {
+	err := service.InitClients()
+	if err != nil {
+		return err
+	}
+
+	list, err := etcd.GetService("")
+	if err != nil {
+		return err
+	}
+	g.Lock()
+	for _, s := range list {
+		g.pending[s.Name] = true
+	}
+	g.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	g.loadPending(ctx)
+	go g.watch(ctx)
+
+	return nil
+}
+
+// Stop stops watching etcd
+func (g *Gateway) Stop() {
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// ListenAndServe starts the gateway and serves HTTP on addr
+func (g *Gateway) ListenAndServe(addr string) error {
+	if err := g.Start(); err != nil {
+		return err
+	}
+	log.Info("gateway start", addr)
+	return http.ListenAndServe(addr, g)
+}
+
+func (g *Gateway) watch(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	rch := etcd.WatcherService(ctx, "")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// retry the services whose client was not connected yet
+		case wresp, ok := <-rch:
+			if !ok {
+				return
+			}
+			for _, ev := range wresp.Events {
+				var name string
+				switch ev.Type {
+				case mvccpb.PUT:
+					// a new instance may come with new descriptors, reload its routes
+					var s etcd.Service
+					if err := json.Unmarshal(ev.Kv.Value, &s); err != nil {
+						continue
+					}
+					name = s.Name
+				case mvccpb.DELETE:
+					// the routes are dropped by loadPending when it was the last instance
+					name = etcd.ServiceNameFromKey(string(ev.Kv.Key))
+				}
+				if name == "" {
+					continue
+				}
+				g.Lock()
+				g.pending[name] = true
+				g.Unlock()
+			}
+		}
+		g.loadPending(ctx)
+	}
+}
+
+// loadPending resolves the annotation routes of the services that changed since the last load
+func (g *Gateway) loadPending(ctx context.Context) {
+	g.RLock()
+	var names = make([]string, 0, len(g.pending))
+	for name := range g.pending {
+		names = append(names, name)
+	}
+	g.RUnlock()
+
+	for _, name := range names {
+		c, err := service.GetClient(name)
+		if err != nil {
+			if list, gerr := etcd.GetService(name); gerr == nil && len(list) == 0 {
+				g.drop(name)
+			}
+			// otherwise the client is not connected yet, try again later
+			continue
+		}
+		rctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+		routes, err := loadRoutes(rctx, c, name)
+		cancel()
+		if err != nil {
+			// keep the current routes and the service pending, the next tick retries
+			log.Errorf("gateway resolve service failed, name = %s, err = %v", name, err)
+			continue
+		}
+		g.Lock()
+		delete(g.pending, name)
+		g.routes[name] = routes
+		g.sortRoutes()
+		g.Unlock()
+	}
+}
+
+// drop removes the routes of a service whose last instance is gone
+func (g *Gateway) drop(name string) {
+	g.Lock()
+	defer g.Unlock()
+	delete(g.pending, name)
+	if _, ok := g.routes[name]; !ok {
+		return
+	}
+	delete(g.routes, name)
+	g.sortRoutes()
+	log.Infof("gateway service %s has no instance, routes removed", name)
+}
+
+// sortRoutes orders the routes of all the services by specificity, so that the first match wins,
+// it must be called with the lock held
+func (g *Gateway) sortRoutes() {
+	var list []*route
+	for _, routes := range g.routes {
+		list = append(list, routes...)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if c := list[i].tmpl.compare(list[j].tmpl); c != 0 {
+			return c < 0
+		}
+		if list[i].service != list[j].service {
+			return list[i].service < list[j].service
+		}
+		return list[i].method.GetName() < list[j].method.GetName()
+	})
+	g.ordered = list
+}
+
+func loadRoutes(ctx context.Context, c *service.Client, name string) ([]*route, error) {
+	sd, err := c.GetProxy().ResolveService(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var routes []*route
+	for _, md := range sd.GetMethods() {
+		rule := schema.HTTPRule(md)
+		if rule == nil {
+			continue
+		}
+		list, err := newRoutes(name, md, rule)
+		if err != nil {
+			log.Errorf("gateway http rule invalid, err = %v", err)
+			continue
+		}
+		routes = append(routes, list...)
+	}
+	return routes, nil
+}
+
+func (g *Gateway) match(r *http.Request) (*route, map[string]string) {
+	g.RLock()
+	defer g.RUnlock()
+	path := r.URL.EscapedPath()
+	for _, rt := range g.ordered {
+		if rt.verb != r.Method {
+			continue
+		}
+		if vars, ok := rt.tmpl.match(path); ok {
+			return rt, vars
+		}
+	}
+	return nil, nil
+}
+
+// defaultRoute resolves POST /<service>/<method>
+func (g *Gateway) defaultRoute(r *http.Request) (*route, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, status.Errorf(codes.NotFound, "no route for %s %s", r.Method, r.URL.Path)
+	}
+	if r.Method != http.MethodPost {
+		return nil, errMethodNotAllowed
+	}
+	c, err := service.GetClient(parts[0])
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "service %s not found", parts[0])
+	}
+	sd, err := c.GetProxy().ResolveService(r.Context(), parts[0])
+	if err != nil {
+		return nil, err
+	}
+	md, err := sd.FindMethodByName(parts[1])
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &route{
+		service: parts[0],
+		method:  md.AsProtoreflectDescriptor(),
+		verb:    http.MethodPost,
+		body:    "*",
+	}, nil
+}
+
+// ResolveService resolves the service descriptor through reflection on one of its instances
+func (g *Gateway) ResolveService(ctx context.Context, name string) (*desc.ServiceDescriptor, error) {
+	c, err := service.GetClient(name)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := c.GetProxy().ResolveService(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return sd.ServiceDescriptor, nil
+}
+
+// ResolveMessage resolves the message descriptor through reflection on the known services
+func (g *Gateway) ResolveMessage(ctx context.Context, name string) (*desc.MessageDescriptor, error) {
+	g.RLock()
+	var names = make([]string, 0, len(g.routes))
+	for n := range g.routes {
+		names = append(names, n)
+	}
+	g.RUnlock()
+
+	for _, n := range names {
+		c, err := service.GetClient(n)
+		if err != nil {
+			continue
+		}
+		md, err := c.GetProxy().ResolveMessage(ctx, name)
+		if err == nil {
+			return md.AsProtoreflectDescriptor(), nil
+		}
+	}
+	return nil, fmt.Errorf("message %s not found", name)
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt, vars := g.match(r)
+	// the annotated routes take precedence over the documents
+	if rt == nil && r.Method == http.MethodGet && (strings.HasPrefix(r.URL.Path, schema.OpenAPIPath) || strings.HasPrefix(r.URL.Path, schema.SchemaPath)) {
+		g.schema.ServeHTTP(w, r)
+		return
+	}
+	if rt == nil {
+		var err error
+		rt, err = g.defaultRoute(r)
+		if err == errMethodNotAllowed {
+			w.Header().Set("Allow", http.MethodPost)
+			err = status.Errorf(codes.Unimplemented, "method %s is not allowed, use POST", r.Method)
+			writeStatus(w, proxy.NewResult(nil, nil, err), http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			writeResult(w, proxy.NewResult(nil, nil, err))
+			return
+		}
+	}
+
+	if rt.method.IsClientStreaming() {
+		writeResult(w, proxy.NewResult(nil, nil, status.Errorf(codes.Unimplemented, "client streaming method %s is not supported", rt.method.GetFullyQualifiedName())))
+		return
+	}
+
+	if g.maxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, g.maxBody)
+	}
+	msg, err := buildMessage(rt, r, vars)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = status.Errorf(codes.InvalidArgument, "request body is larger than %d bytes", tooLarge.Limit)
+		writeStatus(w, proxy.NewResult(nil, nil, err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeResult(w, proxy.NewResult(nil, nil, status.Error(codes.InvalidArgument, err.Error())))
+		return
+	}
+
+	c, err := service.GetClient(rt.service)
+	if err != nil {
+		writeResult(w, proxy.NewResult(nil, nil, status.Error(codes.Unavailable, err.Error())))
+		return
+	}
+
+	// continue the trace of the caller, the client interceptor starts the span of the backend call
+	r = r.WithContext(extend.ExtractHTTP(r.Context(), r.Header))
+	md := g.metadataFromRequest(r)
+	if rt.method.IsServerStreaming() {
+		g.serveStream(w, r, c, rt, msg, md)
+		return
+	}
+
+	res, err := c.ProxyInvoke(r.Context(), rt.method.GetName(), msg, md, g.marshal...)
+	if err != nil {
+		writeResult(w, proxy.NewResult(nil, nil, err))
+		return
+	}
+	if res.Code != codes.OK {
+		writeResult(w, res)
+		return
+	}
+	body, err := selectResponse(rt, res.Response)
+	if err != nil {
+		writeResult(w, proxy.NewResult(res.Header, res.Trailer, status.Error(codes.Internal, err.Error())))
+		return
+	}
+	writeMetadata(w, res.Header, res.Trailer)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// serveStream relays a server streaming call as server-sent events, one "message" event per response
+// and a final "error" event carrying the status when the stream fails
+func (g *Gateway) serveStream(w http.ResponseWriter, r *http.Request, c *service.Client, rt *route, msg []byte, md metadata.MD) {
+	ss, err := c.GetProxy().InvokeServerStream(r.Context(), rt.service, rt.method.GetName(), msg, md, g.marshal...)
+	if err != nil {
+		writeResult(w, proxy.NewResult(nil, nil, err))
+		return
+	}
+	header, err := ss.Header()
+	if err != nil {
+		writeResult(w, proxy.NewResult(nil, nil, err))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	writeMetadata(w, header, nil)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		resp, err := ss.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			b, _ := proxy.NewResult(header, ss.Trailer(), err).StatusJSON()
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", b)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return
+		}
+		body, err := selectResponse(rt, resp)
+		if err != nil {
+			body = resp
+		}
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", body)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// metadataFromRequest forwards the configured headers and every Grpc-Metadata-* header
+func (g *Gateway) metadataFromRequest(r *http.Request) metadata.MD {
+	var md = metadata.MD{}
+	for _, h := range g.headers {
+		if vals := r.Header.Values(h); len(vals) > 0 {
+			md.Append(strings.ToLower(h), vals...)
+		}
+	}
+	for k, vals := range r.Header {
+		if strings.HasPrefix(k, MetadataHeaderPrefix) {
+			md.Append(strings.ToLower(strings.TrimPrefix(k, MetadataHeaderPrefix)), vals...)
+		}
+	}
+	return md
+}
+
+func writeMetadata(w http.ResponseWriter, header, trailer metadata.MD) {
+	for k, vals := range header {
+		if k == "content-type" {
+			continue
+		}
+		for _, v := range vals {
+			w.Header().Add(MetadataHeaderPrefix+k, v)
+		}
+	}
+	for k, vals := range trailer {
+		for _, v := range vals {
+			w.Header().Add(TrailerHeaderPrefix+k, v)
+		}
+	}
+}
+
+// writeResult writes a failed call as its google.rpc.Status JSON with the mapped HTTP status
+func writeResult(w http.ResponseWriter, res *proxy.Result) {
+	writeStatus(w, res, HTTPStatusFromCode(res.Code))
+}
+
+// writeStatus writes a failed call as its google.rpc.Status JSON with the HTTP status code
+func writeStatus(w http.ResponseWriter, res *proxy.Result, code int) {
+	b, err := res.StatusJSON()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeMetadata(w, res.Header, res.Trailer)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
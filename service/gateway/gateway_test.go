@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+)
+
+func TestDrop(t *testing.T) {
+	g := New()
+	for name, path := range map[string]string{"order": "/v1/orders/{id}", "user": "/v1/users/{id}"} {
+		tmpl, err := parseTemplate(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.routes[name] = []*route{{service: name, verb: "GET", tmpl: tmpl}}
+	}
+	g.pending["order"] = true
+	g.sortRoutes()
+
+	g.drop("order")
+	if _, ok := g.routes["order"]; ok || g.pending["order"] {
+		t.Fatalf("routes = %v, pending = %v, want order removed", g.routes, g.pending)
+	}
+	if len(g.ordered) != 1 || g.ordered[0].service != "user" {
+		t.Fatalf("ordered = %v, want the route of user only", g.ordered)
+	}
+}
+
+func TestDefaultRouteMethod(t *testing.T) {
+	g := New()
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		allow  string
+	}{
+		{method: http.MethodGet, path: "/order/Create", code: http.StatusMethodNotAllowed, allow: http.MethodPost},
+		{method: http.MethodPut, path: "/order/Create", code: http.StatusMethodNotAllowed, allow: http.MethodPost},
+		{method: http.MethodGet, path: "/order/Create/1", code: http.StatusNotFound},
+		{method: http.MethodPost, path: "/missing/Create", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code || w.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s = %d Allow %q, want %d Allow %q", tt.method, tt.path, w.Code, w.Header().Get("Allow"), tt.code, tt.allow)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s Content-Type = %s, want the status JSON", tt.method, tt.path, ct)
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	files, err := (&protoparse.Parser{Accessor: protoparse.FileContentsFromMap(map[string]string{
+		"order.proto": `syntax = "proto3";
+package test;
+message Order { string name = 1; }
+service OrderService { rpc Create(Order) returns (Order); }`,
+	})}).ParseFiles("order.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := files[0].FindService("test.OrderService").FindMethodByName("Create")
+	tmpl, err := parseTemplate("/v1/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := New(WithMaxBodySize(16))
+	g.routes["test.OrderService"] = []*route{{service: "test.OrderService", method: md, verb: http.MethodPost, tmpl: tmpl, body: "*"}}
+	g.sortRoutes()
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", strings.NewReader(`{"name":"a name longer than the limit"}`)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("code = %d, want 413, body = %s", w.Code, w.Body)
+	}
+
+	msg, err := buildMessage(g.routes["test.OrderService"][0], httptest.NewRequest(http.MethodPost, "/v1/orders", strings.NewReader(`{"name":"a"}`)), nil)
+	if err != nil || string(msg) != `{"name":"a"}` {
+		t.Fatalf("buildMessage = %s, %v", msg, err)
+	}
+}
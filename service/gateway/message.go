@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/liuyp5181/base/service/proxy"
+)
+
+// buildMessage assembles the JSON request message from the body, path variables and query parameters
+func buildMessage(rt *route, r *http.Request, vars map[string]string) ([]byte, error) {
+	input := rt.method.GetInputType()
+	var msg = make(map[string]interface{})
+
+	if rt.body != "" {
+		data, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			// kept as it is so that the gateway answers 413
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read body failed, err = %v", err)
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) > 0 {
+			if rt.body == "*" {
+				dec := json.NewDecoder(bytes.NewReader(data))
+				dec.UseNumber()
+				if err = dec.Decode(&msg); err != nil {
+					return nil, fmt.Errorf("body is not a JSON object, err = %v", err)
+				}
+				jsonNames(msg, input)
+			} else {
+				if !json.Valid(data) {
+					return nil, fmt.Errorf("body is not valid JSON")
+				}
+				var value interface{} = json.RawMessage(data)
+				// a message body is decoded so that the path variables inside it are merged
+				if fd := findField(input, rt.body); fd != nil && fd.GetMessageType() != nil && !fd.IsRepeated() {
+					var m map[string]interface{}
+					dec := json.NewDecoder(bytes.NewReader(data))
+					dec.UseNumber()
+					if dec.Decode(&m) == nil && m != nil {
+						jsonNames(m, fd.GetMessageType())
+						value = m
+					}
+				}
+				if err = setField(msg, input, rt.body, value, false); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for k, v := range vars {
+		if err := setField(msg, input, k, v, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// query parameters populate the fields not bound by the path or the body
+	if rt.body != "*" {
+		for k, v := range r.URL.Query() {
+			if _, ok := vars[k]; ok {
+				continue
+			}
+			if err := setField(msg, input, k, v, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return json.Marshal(msg)
+}
+
+// jsonNames renames the keys of a JSON message from the field names to the JSON names, as setField
+// writes them. Unknown keys are kept for protojson to report
+func jsonNames(msg map[string]interface{}, md *desc.MessageDescriptor) {
+	for k, v := range msg {
+		fd := md.FindFieldByName(k)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(k)
+		}
+		if fd == nil {
+			continue
+		}
+		name := fd.GetJSONName()
+		if name != k {
+			delete(msg, k)
+			msg[name] = v
+		}
+
+		if fd.IsMap() {
+			vt := fd.GetMapValueType().GetMessageType()
+			if m, ok := v.(map[string]interface{}); ok && vt != nil {
+				for _, e := range m {
+					if em, ok := e.(map[string]interface{}); ok {
+						jsonNames(em, vt)
+					}
+				}
+			}
+			continue
+		}
+		mt := fd.GetMessageType()
+		if mt == nil || proxy.IsWellKnown(mt) {
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			jsonNames(v, mt)
+		case []interface{}:
+			for _, e := range v {
+				if em, ok := e.(map[string]interface{}); ok {
+					jsonNames(em, mt)
+				}
+			}
+		}
+	}
+}
+
+// findField returns the field at the dotted path, or nil
+func findField(md *desc.MessageDescriptor, path string) *desc.FieldDescriptor {
+	var fd *desc.FieldDescriptor
+	for _, p := range strings.Split(path, ".") {
+		if md == nil {
+			return nil
+		}
+		fd = md.FindFieldByName(p)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(p)
+		}
+		if fd == nil {
+			return nil
+		}
+		md = fd.GetMessageType()
+	}
+	return fd
+}
+
+// setField sets the value at the dotted field path, creating the intermediate messages.
+// Field names are converted to their JSON names so that they do not collide with the body
+func setField(msg map[string]interface{}, md *desc.MessageDescriptor, path string, value interface{}, query bool) error {
+	parts := strings.Split(path, ".")
+	for i, p := range parts {
+		fd := md.FindFieldByName(p)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(p)
+		}
+		if fd == nil {
+			return fmt.Errorf("field %s not found in %s", path, md.GetFullyQualifiedName())
+		}
+		name := fd.GetJSONName()
+
+		if i == len(parts)-1 {
+			if values, ok := value.([]string); ok && query {
+				if fd.IsRepeated() {
+					msg[name] = values
+				} else {
+					msg[name] = values[len(values)-1]
+				}
+				return nil
+			}
+			msg[name] = value
+			return nil
+		}
+
+		if fd.GetMessageType() == nil || fd.IsRepeated() {
+			return fmt.Errorf("field %s is not a message, path = %s", p, path)
+		}
+		next, ok := msg[name].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			msg[name] = next
+		}
+		msg = next
+		md = fd.GetMessageType()
+	}
+	return nil
+}
+
+// selectResponse returns the response_body field of the JSON response, or the whole response
+func selectResponse(rt *route, resp []byte) ([]byte, error) {
+	if rt.responseBody == "" || rt.responseBody == "*" {
+		return resp, nil
+	}
+	fd := rt.method.GetOutputType().FindFieldByName(rt.responseBody)
+	if fd == nil {
+		return nil, fmt.Errorf("response_body field %s not found", rt.responseBody)
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(resp, &m); err != nil {
+		return nil, err
+	}
+	if v, ok := m[fd.GetJSONName()]; ok {
+		return v, nil
+	}
+	if v, ok := m[fd.GetName()]; ok {
+		return v, nil
+	}
+	return []byte("null"), nil
+}
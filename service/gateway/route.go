@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/liuyp5181/base/service/schema"
+	"google.golang.org/genproto/googleapis/api/annotations"
+)
+
+const (
+	segLiteral = iota
+	segWildcard
+	segDeepWildcard
+)
+
+type segment struct {
+	kind  int
+	value string
+	field string
+}
+
+// template is a compiled google.api.http path template, e.g. /v1/{name=messages/*}:publish
+type template struct {
+	segments []segment
+	verb     string
+}
+
+// route binds an HTTP method and path template to a gRPC method
+type route struct {
+	service      string
+	method       *desc.MethodDescriptor
+	verb         string
+	tmpl         *template
+	body         string
+	responseBody string
+}
+
+// parseTemplate compiles a path template as described in google/api/http.proto
+func parseTemplate(path string) (*template, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("template must start with '/', template = %s", path)
+	}
+	var t template
+	s := path[1:]
+	if i := strings.LastIndex(s, ":"); i >= 0 && !strings.Contains(s[i:], "}") && !strings.Contains(s[i:], "/") {
+		t.verb = s[i+1:]
+		s = s[:i]
+	}
+
+	for len(s) > 0 {
+		var part string
+		if s[0] == '{' {
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable, template = %s", path)
+			}
+			part, s = s[:end+1], s[end+1:]
+			segs, err := parseVariable(part[1 : len(part)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%v, template = %s", err, path)
+			}
+			t.segments = append(t.segments, segs...)
+		} else {
+			end := strings.IndexByte(s, '/')
+			if end < 0 {
+				end = len(s)
+			}
+			part, s = s[:end], s[end:]
+			t.segments = append(t.segments, parseSegment(part, ""))
+		}
+		if len(s) > 0 {
+			if s[0] != '/' {
+				return nil, fmt.Errorf("unexpected %q, template = %s", s[0], path)
+			}
+			s = s[1:]
+		}
+	}
+
+	for i, seg := range t.segments {
+		if seg.kind == segDeepWildcard && i != len(t.segments)-1 {
+			return nil, fmt.Errorf("'**' must be the last segment, template = %s", path)
+		}
+	}
+	return &t, nil
+}
+
+func parseVariable(v string) ([]segment, error) {
+	field, pattern := v, "*"
+	if i := strings.IndexByte(v, '='); i >= 0 {
+		field, pattern = v[:i], v[i+1:]
+	}
+	if field == "" || pattern == "" {
+		return nil, fmt.Errorf("invalid variable {%s}", v)
+	}
+	var segs []segment
+	for _, p := range strings.Split(pattern, "/") {
+		if p == "" {
+			return nil, fmt.Errorf("invalid variable {%s}", v)
+		}
+		segs = append(segs, parseSegment(p, field))
+	}
+	return segs, nil
+}
+
+func parseSegment(s, field string) segment {
+	switch s {
+	case "*":
+		return segment{kind: segWildcard, field: field}
+	case "**":
+		return segment{kind: segDeepWildcard, field: field}
+	}
+	return segment{kind: segLiteral, value: s, field: field}
+}
+
+// match matches an escaped request path and returns the captured variables by field path
+func (t *template) match(path string) (map[string]string, bool) {
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	var captured = make(map[string][]string)
+	var i int
+	for _, seg := range t.segments {
+		if seg.kind == segDeepWildcard {
+			if seg.field != "" {
+				captured[seg.field] = append(captured[seg.field], parts[i:]...)
+			}
+			i = len(parts)
+			continue
+		}
+		if i >= len(parts) || parts[i] == "" {
+			return nil, false
+		}
+		if seg.kind == segLiteral && parts[i] != seg.value {
+			return nil, false
+		}
+		if seg.field != "" {
+			captured[seg.field] = append(captured[seg.field], parts[i])
+		}
+		i++
+	}
+	if i != len(parts) {
+		return nil, false
+	}
+
+	var vars = make(map[string]string, len(captured))
+	for k, v := range captured {
+		for j := range v {
+			if u, err := url.PathUnescape(v[j]); err == nil {
+				v[j] = u
+			}
+		}
+		vars[k] = strings.Join(v, "/")
+	}
+	return vars, true
+}
+
+// compare orders the templates by specificity, it is negative when t is more specific than o. The
+// segments are compared in order, a literal before a variable and a variable before '**', then the
+// longer template and the one with a verb come first
+func (t *template) compare(o *template) int {
+	for i := 0; i < len(t.segments) && i < len(o.segments); i++ {
+		if c := t.segments[i].rank() - o.segments[i].rank(); c != 0 {
+			return c
+		}
+	}
+	if c := len(o.segments) - len(t.segments); c != 0 {
+		return c
+	}
+	switch {
+	case t.verb != "" && o.verb == "":
+		return -1
+	case t.verb == "" && o.verb != "":
+		return 1
+	}
+	return 0
+}
+
+// rank is 0 for a literal, 1 for '*' and 2 for '**'
+func (s segment) rank() int {
+	return s.kind
+}
+
+// newRoutes builds a route for the rule and every additional binding of it
+func newRoutes(service string, md *desc.MethodDescriptor, rule *annotations.HttpRule) ([]*route, error) {
+	var list []*route
+	for _, b := range schema.Bindings(rule) {
+		t, err := parseTemplate(b.Path)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &route{
+			service:      service,
+			method:       md,
+			verb:         b.Method,
+			tmpl:         t,
+			body:         b.Body,
+			responseBody: b.ResponseBody,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		path     string
+		segments []segment
+		verb     string
+		err      string
+	}{
+		{path: "/v1/messages", segments: []segment{{value: "v1"}, {value: "messages"}}},
+		{path: "/v1/messages/{id}", segments: []segment{{value: "v1"}, {value: "messages"}, {kind: segWildcard, field: "id"}}},
+		{
+			path:     "/v1/{name=messages/*}:publish",
+			segments: []segment{{value: "v1"}, {value: "messages", field: "name"}, {kind: segWildcard, field: "name"}},
+			verb:     "publish",
+		},
+		{path: "/v1/{path=**}", segments: []segment{{value: "v1"}, {kind: segDeepWildcard, field: "path"}}},
+		{path: "/v1/*/items", segments: []segment{{value: "v1"}, {kind: segWildcard}, {value: "items"}}},
+		{path: "v1/messages", err: "must start with '/'"},
+		{path: "/v1/{id", err: "unterminated variable"},
+		{path: "/v1/{=*}", err: "invalid variable"},
+		{path: "/v1/{id=}", err: "invalid variable"},
+		{path: "/v1/{name=a//b}", err: "invalid variable"},
+		{path: "/v1/{id}x", err: "unexpected 'x'"},
+		{path: "/v1/**/items", err: "'**' must be the last segment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseTemplate(tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseTemplate err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTemplate err = %v", err)
+			}
+			if !reflect.DeepEqual(got.segments, tt.segments) || got.verb != tt.verb {
+				t.Fatalf("parseTemplate = %+v :%s, want %+v :%s", got.segments, got.verb, tt.segments, tt.verb)
+			}
+		})
+	}
+}
+
+func TestTemplateMatch(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		path string
+		vars map[string]string
+		ok   bool
+	}{
+		{tmpl: "/v1/messages", path: "/v1/messages", vars: map[string]string{}, ok: true},
+		{tmpl: "/v1/messages", path: "/v1/messages/1"},
+		{tmpl: "/v1/messages/{id}", path: "/v1/messages/42", vars: map[string]string{"id": "42"}, ok: true},
+		{tmpl: "/v1/messages/{id}", path: "/v1/messages/"},
+		{tmpl: "/v1/messages/{id}", path: "/v1/messages"},
+		{tmpl: "/v1/messages/{id}", path: "/v1/messages/a%2Fb", vars: map[string]string{"id": "a/b"}, ok: true},
+		{
+			tmpl: "/v1/{name=shelves/*/books/*}",
+			path: "/v1/shelves/1/books/2",
+			vars: map[string]string{"name": "shelves/1/books/2"},
+			ok:   true,
+		},
+		{tmpl: "/v1/{name=shelves/*/books/*}", path: "/v1/shelves/1/notes/2"},
+		{
+			tmpl: "/v1/users/{user.id}/items/{item_id}",
+			path: "/v1/users/7/items/9",
+			vars: map[string]string{"user.id": "7", "item_id": "9"},
+			ok:   true,
+		},
+		{tmpl: "/v1/files/{path=**}", path: "/v1/files/a/b/c.txt", vars: map[string]string{"path": "a/b/c.txt"}, ok: true},
+		{tmpl: "/v1/files/{path=**}", path: "/v1/files", vars: map[string]string{"path": ""}, ok: true},
+		{tmpl: "/v1/files/**", path: "/v1/files/a/b", vars: map[string]string{}, ok: true},
+		{tmpl: "/v1/{name=messages/*}:publish", path: "/v1/messages/3:publish", vars: map[string]string{"name": "messages/3"}, ok: true},
+		{tmpl: "/v1/{name=messages/*}:publish", path: "/v1/messages/3"},
+		{tmpl: "/v1/{name=messages/*}:publish", path: "/v1/messages/3:undo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl+" "+tt.path, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.tmpl)
+			if err != nil {
+				t.Fatalf("parseTemplate err = %v", err)
+			}
+			vars, ok := tmpl.match(tt.path)
+			if ok != tt.ok {
+				t.Fatalf("match = %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(vars, tt.vars) {
+				t.Fatalf("match vars = %v, want %v", vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestTemplateCompare(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		// want is paths ordered from the most specific
+		want []string
+	}{
+		{
+			name:  "literal before variable",
+			paths: []string{"/v1/{id}", "/v1/me"},
+			want:  []string{"/v1/me", "/v1/{id}"},
+		},
+		{
+			name:  "variable before deep wildcard",
+			paths: []string{"/v1/{path=**}", "/v1/{id}"},
+			want:  []string{"/v1/{id}", "/v1/{path=**}"},
+		},
+		{
+			name:  "earlier segment first",
+			paths: []string{"/v1/{id}/items", "/v1/users/{id}"},
+			want:  []string{"/v1/users/{id}", "/v1/{id}/items"},
+		},
+		{
+			name:  "longer first",
+			paths: []string{"/v1/{path=**}", "/v1/{id}/items/{item}", "/v1/{id}"},
+			want:  []string{"/v1/{id}/items/{item}", "/v1/{id}", "/v1/{path=**}"},
+		},
+		{
+			name:  "verb first",
+			paths: []string{"/v1/{id}", "/v1/{id}:cancel"},
+			want:  []string{"/v1/{id}:cancel", "/v1/{id}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tmpls = make(map[*template]string)
+			var list []*template
+			for _, p := range tt.paths {
+				tmpl, err := parseTemplate(p)
+				if err != nil {
+					t.Fatalf("parseTemplate(%s) err = %v", p, err)
+				}
+				tmpls[tmpl] = p
+				list = append(list, tmpl)
+			}
+			sort.SliceStable(list, func(i, j int) bool {
+				return list[i].compare(list[j]) < 0
+			})
+			var got []string
+			for _, tmpl := range list {
+				got = append(got, tmpls[tmpl])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MarshalOptions controls the JSON mapping of proxied messages
+type MarshalOptions struct {
+	// EmitDefaults writes fields that hold their zero value instead of omitting them
+	EmitDefaults bool
+	// OrigName uses the field names of the .proto file instead of lowerCamelCase JSON names
+	OrigName bool
+	// EnumsAsInts writes enums as numbers instead of their names
+	EnumsAsInts bool
+	// Int64AsNumbers writes 64 bit integers as JSON numbers, by default they are strings as the
+	// proto3 JSON mapping requires, so that clients parsing numbers as doubles do not lose precision
+	Int64AsNumbers bool
+	// AnyResolver resolves the type URLs of google.protobuf.Any values in both directions,
+	// when nil the types known to the reflection client are used
+	AnyResolver jsonpb.AnyResolver
+}
+
+func (o MarshalOptions) marshaler() *jsonpb.Marshaler {
+	return &jsonpb.Marshaler{
+		EmitDefaults: o.EmitDefaults,
+		OrigName:     o.OrigName,
+		EnumsAsInts:  o.EnumsAsInts,
+		AnyResolver:  o.AnyResolver,
+	}
+}
+
+func (o MarshalOptions) unmarshaler() *jsonpb.Unmarshaler {
+	return &jsonpb.Unmarshaler{
+		AnyResolver: o.AnyResolver,
+	}
+}
+
+// marshalCallOption carries MarshalOptions through the grpc.CallOption list of a single call
+type marshalCallOption struct {
+	grpc.EmptyCallOption
+	opts MarshalOptions
+}
+
+// CallMarshalOptions overrides the MarshalOptions of the proxy for one call
+func CallMarshalOptions(o MarshalOptions) grpc.CallOption {
+	return marshalCallOption{opts: o}
+}
+
+// splitCallOptions returns the MarshalOptions of the call and the remaining gRPC options
+func splitCallOptions(def MarshalOptions, opts []grpc.CallOption) (MarshalOptions, []grpc.CallOption) {
+	var list = make([]grpc.CallOption, 0, len(opts))
+	for _, o := range opts {
+		if mo, ok := o.(marshalCallOption); ok {
+			def = mo.opts
+			continue
+		}
+		list = append(list, o)
+	}
+	return def, list
+}
+
+func marshalMessage(m *dynamic.Message, o MarshalOptions) ([]byte, error) {
+	b, err := m.MarshalJSONPB(o.marshaler())
+	if err != nil {
+		return nil, err
+	}
+	if !o.Int64AsNumbers {
+		return b, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err = dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	int64AsNumbers(m.GetMessageDescriptor(), v)
+	return json.Marshal(v)
+}
+
+// int64AsNumbers replaces the quoted 64 bit integers of the decoded JSON message v with numbers
+func int64AsNumbers(md *desc.MessageDescriptor, v interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		// wrappers are written as their bare value, handled by the parent field
+		return
+	}
+	for k, val := range obj {
+		fd := findField(md, k)
+		if fd == nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if m, ok := val.(map[string]interface{}); ok {
+				for mk, mv := range m {
+					m[mk] = int64Value(fd.GetMapValueType(), mv)
+				}
+			}
+		case fd.IsRepeated():
+			if l, ok := val.([]interface{}); ok {
+				for i := range l {
+					l[i] = int64Value(fd, l[i])
+				}
+			}
+		default:
+			obj[k] = int64Value(fd, val)
+		}
+	}
+}
+
+func int64Value(fd *desc.FieldDescriptor, v interface{}) interface{} {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		if s, ok := v.(string); ok {
+			return json.Number(s)
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
+		switch fd.GetMessageType().GetFullyQualifiedName() {
+		case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+			if s, ok := v.(string); ok {
+				return json.Number(s)
+			}
+		}
+		int64AsNumbers(fd.GetMessageType(), v)
+	}
+	return v
+}
+
+func findField(md *desc.MessageDescriptor, name string) *desc.FieldDescriptor {
+	if fd := md.FindFieldByJSONName(name); fd != nil {
+		return fd
+	}
+	return md.FindFieldByName(name)
+}
+
+// fieldError locates the first field of the JSON input that does not match md, it returns the
+// dotted path of the field and the error of unmarshaling it alone, or an empty path when the
+// input can not be narrowed down
+func fieldError(md *desc.MessageDescriptor, input []byte, o MarshalOptions) (string, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(input, &obj); err != nil {
+		return "", err
+	}
+	for k, raw := range obj {
+		fd := findField(md, k)
+		if fd == nil {
+			return k, fmt.Errorf("unknown field")
+		}
+		one, _ := json.Marshal(map[string]json.RawMessage{k: raw})
+		ferr := dynamic.NewMessage(md).UnmarshalJSONPB(o.unmarshaler(), one)
+		if ferr == nil {
+			continue
+		}
+		if fd.GetMessageType() == nil || IsWellKnown(fd.GetMessageType()) {
+			return k, ferr
+		}
+
+		// descend into the message to find the exact field
+		sub := fd.GetMessageType()
+		switch {
+		case fd.IsMap():
+			var m map[string]json.RawMessage
+			if json.Unmarshal(raw, &m) == nil && fd.GetMapValueType().GetMessageType() != nil {
+				for mk, mv := range m {
+					if p, err := fieldError(fd.GetMapValueType().GetMessageType(), mv, o); err != nil {
+						return joinPath(fmt.Sprintf("%s[%q]", k, mk), p), err
+					}
+				}
+			}
+		case fd.IsRepeated():
+			var l []json.RawMessage
+			if json.Unmarshal(raw, &l) == nil {
+				for i, e := range l {
+					if p, err := fieldError(sub, e, o); err != nil {
+						return joinPath(fmt.Sprintf("%s[%d]", k, i), p), err
+					}
+				}
+			}
+		default:
+			if p, err := fieldError(sub, raw, o); err != nil {
+				return joinPath(k, p), err
+			}
+		}
+		return k, ferr
+	}
+	return "", nil
+}
+
+func joinPath(parent, child string) string {
+	if child == "" {
+		return parent
+	}
+	if strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
+
+// IsWellKnown reports whether the message has a special JSON mapping that is not an object of its fields,
+// e.g. google.protobuf.Timestamp as a string or google.protobuf.Struct whose keys are not field names
+func IsWellKnown(md *desc.MessageDescriptor) bool {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Any", "google.protobuf.Timestamp", "google.protobuf.Duration",
+		"google.protobuf.FieldMask", "google.protobuf.Struct", "google.protobuf.Value",
+		"google.protobuf.ListValue", "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value", "google.protobuf.Int32Value",
+		"google.protobuf.UInt32Value", "google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
@@ -2,12 +2,19 @@ package proxy
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+
 	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"github.com/jhump/protoreflect/grpcreflect"
 	"github.com/pkg/errors"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
-	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 // Proxy is a dynamic gRPC client that performs reflection
@@ -15,27 +22,91 @@ type Proxy struct {
 	cc        *grpc.ClientConn
 	reflector Reflector
 	stub      Stub
+	marshal   MarshalOptions
+}
+
+type Option func(*Proxy)
+
+// WithMarshalOptions sets the JSON mapping used by every call of the proxy,
+// a single call can override it with CallMarshalOptions
+func WithMarshalOptions(o MarshalOptions) Option {
+	return func(p *Proxy) {
+		p.marshal = o
+	}
+}
+
+// Result is the outcome of a proxied call as seen by the backend
+type Result struct {
+	// Response is the JSON encoded response message, nil when Code is not OK
+	Response []byte
+	// Header is the response header metadata sent by the backend
+	Header metadata.MD
+	// Trailer is the response trailer metadata sent by the backend
+	Trailer metadata.MD
+	// Code is the gRPC status code of the call
+	Code codes.Code
+	// Message is the gRPC status message of the call
+	Message string
+	// Details are the google.rpc.Status details, each rendered to JSON
+	Details []json.RawMessage
+
+	stat *status.Status
+}
+
+// Err returns the gRPC status error of the call, or nil when Code is OK
+func (r *Result) Err() error {
+	if r.Code == codes.OK {
+		return nil
+	}
+	if r.stat != nil {
+		return r.stat.Err()
+	}
+	return status.Error(r.Code, r.Message)
+}
+
+// StatusJSON renders the google.rpc.Status of the call to JSON
+func (r *Result) StatusJSON() ([]byte, error) {
+	var details = r.Details
+	if details == nil {
+		details = []json.RawMessage{}
+	}
+	return json.Marshal(struct {
+		Code    int32             `json:"code"`
+		Message string            `json:"message"`
+		Details []json.RawMessage `json:"details"`
+	}{
+		Code:    int32(r.Code),
+		Message: r.Message,
+		Details: details,
+	})
 }
 
 // NewConnect opens a connection to target.
-func NewConnect(ctx context.Context, target string) (*Proxy, error) {
+// Reflection uses grpc.reflection.v1 and falls back to v1alpha when the server does not support it
+func NewConnect(ctx context.Context, target string, opts ...Option) (*Proxy, error) {
 	p := &Proxy{}
+	for _, o := range opts {
+		o(p)
+	}
 	cc, err := grpc.DialContext(ctx, target, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, err
 	}
 	p.cc = cc
-	rc := grpcreflect.NewClient(ctx, rpb.NewServerReflectionClient(p.cc))
+	rc := grpcreflect.NewClientAuto(ctx, p.cc)
 	p.reflector = NewReflector(rc)
 	p.stub = NewStub(grpcdynamic.NewStub(p.cc))
 	return p, nil
 }
 
 // NewClient opens a connection to target.
-func NewClient(ctx context.Context, cc *grpc.ClientConn) *Proxy {
+func NewClient(ctx context.Context, cc *grpc.ClientConn, opts ...Option) *Proxy {
 	p := &Proxy{}
+	for _, o := range opts {
+		o(p)
+	}
 	p.cc = cc
-	rc := grpcreflect.NewClient(ctx, rpb.NewServerReflectionClient(p.cc))
+	rc := grpcreflect.NewClientAuto(ctx, p.cc)
 	p.reflector = NewReflector(rc)
 	p.stub = NewStub(grpcdynamic.NewStub(p.cc))
 	return p
@@ -53,18 +124,117 @@ func (p *Proxy) Call(ctx context.Context,
 	opts ...grpc.CallOption,
 ) ([]byte, error) {
 
-	invocation, err := p.reflector.CreateInvocation(ctx, serviceName, methodName, message)
+	res, err := p.Invoke(ctx, serviceName, methodName, message, nil, opts...)
 	if err != nil {
 		return nil, err
 	}
+	if err = res.Err(); err != nil {
+		return nil, err
+	}
+	return res.Response, nil
+}
 
-	outputMsg, err := p.stub.InvokeRPC(ctx, invocation, opts...)
+// Invoke performs the gRPC call with md as request metadata and returns everything the backend sent back.
+// The returned error is only set when the call could not be made, a failed call is reported through Result.Code
+func (p *Proxy) Invoke(ctx context.Context,
+	serviceName, methodName string,
+	message []byte,
+	md metadata.MD,
+	opts ...grpc.CallOption,
+) (*Result, error) {
+
+	mo, opts := splitCallOptions(p.marshal, opts)
+	invocation, err := p.reflector.CreateInvocation(ctx, serviceName, methodName, message, mo)
 	if err != nil {
 		return nil, err
 	}
-	m, err := outputMsg.MarshalJSON()
+
+	if len(md) > 0 {
+		out, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Join(out, md))
+	}
+
+	var res Result
+	opts = append(opts, grpc.Header(&res.Header), grpc.Trailer(&res.Trailer))
+	outputMsg, err := p.stub.InvokeRPC(ctx, invocation, opts...)
+	if err != nil {
+		return NewResult(res.Header, res.Trailer, err), nil
+	}
+	m, err := outputMsg.MarshalJSONWithOptions(mo)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to marshal output JSON")
 	}
-	return m, err
+	res.Response = m
+	return &res, nil
+}
+
+// InvokeServerStream starts a server streaming call with md as request metadata
+func (p *Proxy) InvokeServerStream(ctx context.Context,
+	serviceName, methodName string,
+	message []byte,
+	md metadata.MD,
+	opts ...grpc.CallOption,
+) (*ServerStream, error) {
+
+	mo, opts := splitCallOptions(p.marshal, opts)
+	invocation, err := p.reflector.CreateInvocation(ctx, serviceName, methodName, message, mo)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(md) > 0 {
+		out, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Join(out, md))
+	}
+
+	ss, err := p.stub.InvokeServerStream(ctx, invocation, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ss.marshal = mo
+	return ss, nil
+}
+
+// ResolveService returns the descriptor of serviceName obtained through reflection
+func (p *Proxy) ResolveService(ctx context.Context, serviceName string) (*ServiceDescriptor, error) {
+	return p.reflector.ResolveService(ctx, serviceName)
+}
+
+// ResolveMessage returns the descriptor of messageName obtained through reflection
+func (p *Proxy) ResolveMessage(ctx context.Context, messageName string) (*MessageDescriptor, error) {
+	return p.reflector.ResolveMessage(ctx, messageName)
+}
+
+// ListServices returns the names of the services exposed by the backend
+func (p *Proxy) ListServices(ctx context.Context) ([]string, error) {
+	return p.reflector.ListServices(ctx)
+}
+
+// NewResult builds the Result of a call that ended with err
+func NewResult(header, trailer metadata.MD, err error) *Result {
+	stat := status.Convert(err)
+	return &Result{
+		Header:  header,
+		Trailer: trailer,
+		Code:    stat.Code(),
+		Message: stat.Message(),
+		Details: renderDetails(stat),
+		stat:    stat,
+	}
+}
+
+// renderDetails renders every status detail to JSON, details of unknown types keep their raw bytes
+func renderDetails(stat *status.Status) []json.RawMessage {
+	var list []json.RawMessage
+	for _, d := range stat.Proto().GetDetails() {
+		b, err := protojson.Marshal(d)
+		if err != nil {
+			b, _ = json.Marshal(map[string]string{
+				"@type": d.GetTypeUrl(),
+				"value": base64.StdEncoding.EncodeToString(d.GetValue()),
+			})
+		}
+		list = append(list, b)
+	}
+	return list
 }
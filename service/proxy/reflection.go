@@ -2,12 +2,13 @@ package proxy
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // MethodInvocation contains a method and a message used to invoke an RPC
@@ -18,7 +19,13 @@ type MethodInvocation struct {
 
 // Reflector performs reflection on the gRPC service to obtain the method type
 type Reflector interface {
-	CreateInvocation(ctx context.Context, serviceName, methodName string, input []byte) (*MethodInvocation, error)
+	CreateInvocation(ctx context.Context, serviceName, methodName string, input []byte, opts MarshalOptions) (*MethodInvocation, error)
+	// ResolveService returns the descriptor of the service as reported by the backend
+	ResolveService(ctx context.Context, serviceName string) (*ServiceDescriptor, error)
+	// ResolveMessage returns the descriptor of the message as reported by the backend
+	ResolveMessage(ctx context.Context, messageName string) (*MessageDescriptor, error)
+	// ListServices returns the names of the services exposed by the backend
+	ListServices(ctx context.Context) ([]string, error)
 }
 
 // NewReflector creates a new Reflector from the reflection client
@@ -37,19 +44,20 @@ func (r *reflectorImpl) CreateInvocation(ctx context.Context,
 	serviceName,
 	methodName string,
 	input []byte,
+	opts MarshalOptions,
 ) (*MethodInvocation, error) {
 	serviceDesc, err := r.rc.resolveService(ctx, serviceName)
 	if err != nil {
-		return nil, fmt.Errorf("service was not found upstream even though it should have been there err = %v", err)
+		return nil, status.Errorf(codes.NotFound, "service was not found upstream even though it should have been there err = %v", err)
 	}
 	methodDesc, err := serviceDesc.FindMethodByName(methodName)
 	if err != nil {
-		return nil, fmt.Errorf("method not found upstream err = %v", err)
+		return nil, status.Errorf(codes.Unimplemented, "method not found upstream err = %v", err)
 	}
 	inputMessage := methodDesc.GetInputType().NewMessage()
-	err = inputMessage.UnmarshalJSON(input)
+	err = inputMessage.UnmarshalJSONWithOptions(input, opts)
 	if err != nil {
-		return nil, err
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 	return &MethodInvocation{
 		MethodDescriptor: methodDesc,
@@ -57,6 +65,31 @@ func (r *reflectorImpl) CreateInvocation(ctx context.Context,
 	}, nil
 }
 
+// ResolveService returns the descriptor of the service as reported by the backend
+func (r *reflectorImpl) ResolveService(ctx context.Context, serviceName string) (*ServiceDescriptor, error) {
+	serviceDesc, err := r.rc.resolveService(ctx, serviceName)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return serviceDesc, nil
+}
+
+// ResolveMessage returns the descriptor of the message as reported by the backend
+func (r *reflectorImpl) ResolveMessage(ctx context.Context, messageName string) (*MessageDescriptor, error) {
+	d, err := r.rc.ResolveMessage(messageName)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "message %s was not found upstream", messageName)
+	}
+	return &MessageDescriptor{
+		desc: d,
+	}, nil
+}
+
+// ListServices returns the names of the services exposed by the backend
+func (r *reflectorImpl) ListServices(ctx context.Context) ([]string, error) {
+	return r.rc.ListServices()
+}
+
 // reflectionClient performs reflection to obtain descriptors
 type reflectionClient struct {
 	grpcreflectClient
@@ -64,6 +97,8 @@ type reflectionClient struct {
 
 type grpcreflectClient interface {
 	ResolveService(serviceName string) (*desc.ServiceDescriptor, error)
+	ResolveMessage(messageName string) (*desc.MessageDescriptor, error)
+	ListServices() ([]string, error)
 }
 
 // newReflectionClient creates a new ReflectionClient
@@ -142,6 +177,11 @@ type MessageDescriptor struct {
 	desc *desc.MessageDescriptor
 }
 
+// AsProtoreflectDescriptor returns the underlying protoreflect message descriptor
+func (m *MessageDescriptor) AsProtoreflectDescriptor() *desc.MessageDescriptor {
+	return m.desc
+}
+
 // NewMessage creates a new message from the message descriptor
 func (m *MessageDescriptor) NewMessage() *messageImpl {
 	return &messageImpl{
@@ -152,8 +192,12 @@ func (m *MessageDescriptor) NewMessage() *messageImpl {
 type Message interface {
 	// MarshalJSON marshals the Message into JSON
 	MarshalJSON() ([]byte, error)
+	// MarshalJSONWithOptions marshals the Message into JSON with the given options
+	MarshalJSONWithOptions(opts MarshalOptions) ([]byte, error)
 	// UnmarshalJSON unmarshals JSON into a Message
 	UnmarshalJSON(b []byte) error
+	// UnmarshalJSONWithOptions unmarshals JSON into a Message with the given options
+	UnmarshalJSONWithOptions(b []byte, opts MarshalOptions) error
 	// ConvertFrom converts a raw protobuf message into a Message
 	ConvertFrom(target proto.Message) error
 	// AsProtoreflectMessage returns the underlying protoreflect message
@@ -166,18 +210,31 @@ type messageImpl struct {
 }
 
 func (m *messageImpl) MarshalJSON() ([]byte, error) {
-	b, err := m.Message.MarshalJSON()
+	return m.MarshalJSONWithOptions(MarshalOptions{})
+}
+
+func (m *messageImpl) MarshalJSONWithOptions(opts MarshalOptions) ([]byte, error) {
+	b, err := marshalMessage(m.Message, opts)
 	if err != nil {
-		return nil, errors.New("could not marshal backend response into JSON")
+		return nil, fmt.Errorf("could not marshal %s into JSON: %v", m.GetMessageDescriptor().GetFullyQualifiedName(), err)
 	}
 	return b, nil
 }
 
 func (m *messageImpl) UnmarshalJSON(b []byte) error {
-	if err := m.Message.UnmarshalJSON(b); err != nil {
-		return errors.New("input JSON does not match messageImpl type")
+	return m.UnmarshalJSONWithOptions(b, MarshalOptions{})
+}
+
+func (m *messageImpl) UnmarshalJSONWithOptions(b []byte, opts MarshalOptions) error {
+	err := m.Message.UnmarshalJSONPB(opts.unmarshaler(), b)
+	if err == nil {
+		return nil
+	}
+	name := m.GetMessageDescriptor().GetFullyQualifiedName()
+	if path, ferr := fieldError(m.GetMessageDescriptor(), b, opts); path != "" && ferr != nil {
+		return fmt.Errorf("input JSON does not match %s at field %s: %v", name, path, ferr)
 	}
-	return nil
+	return fmt.Errorf("input JSON does not match %s: %v", name, err)
 }
 
 func (m *messageImpl) ConvertFrom(target proto.Message) error {
@@ -2,13 +2,14 @@ package proxy
 
 import (
 	"context"
-	"errors"
-	"fmt"
+	"io"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -17,6 +18,8 @@ type Stub interface {
 	// InvokeRPC calls the backend gRPC method with the message provided in JSON.
 	// This performs reflection against the backend every time it is called.
 	InvokeRPC(ctx context.Context, invocation *MethodInvocation, opts ...grpc.CallOption) (Message, error)
+	// InvokeServerStream calls the backend server streaming gRPC method with the message provided in JSON.
+	InvokeServerStream(ctx context.Context, invocation *MethodInvocation, opts ...grpc.CallOption) (*ServerStream, error)
 }
 
 type stubImpl struct {
@@ -26,6 +29,7 @@ type stubImpl struct {
 type grpcdynamicStub interface {
 	// This must be InvokeRpc with lower-case 'p' and 'c', because that is how the protoreflect library
 	InvokeRpc(ctx context.Context, method *desc.MethodDescriptor, request proto.Message, opts ...grpc.CallOption) (proto.Message, error)
+	InvokeRpcServerStream(ctx context.Context, method *desc.MethodDescriptor, request proto.Message, opts ...grpc.CallOption) (*grpcdynamic.ServerStream, error)
 }
 
 // NewStub creates a new Stub with the passed connection
@@ -45,19 +49,77 @@ func (s *stubImpl) InvokeRPC(
 		invocation.Message.AsProtoreflectMessage(), opts...)
 	if err != nil {
 		stat := status.Convert(err)
-		if err != nil && stat.Code() == codes.Unavailable {
-			return nil, fmt.Errorf("could not connect to backend")
+		if stat.Code() == codes.Unavailable {
+			// keep the details, only the message says the backend is unreachable
+			p := stat.Proto()
+			p.Message = "could not connect to backend: " + p.GetMessage()
+			return nil, status.FromProto(p).Err()
 		}
 
-		// When InvokeRPC returns an error, it should always be a gRPC error, so this should not panic
-		return nil, fmt.Errorf("InvokeRpc err, codes = %d, msg = %s", stat.Code(), stat.Message())
+		// When InvokeRPC returns an error, it should always be a gRPC error, keep it intact so that
+		// the code, message and details reach the caller
+		return nil, stat.Err()
 	}
 	outputMsg := invocation.MethodDescriptor.GetOutputType().NewMessage()
 	err = outputMsg.ConvertFrom(o)
 
 	if err != nil {
-		return nil, errors.New("response from backend could not be converted internally; this is a bug")
+		return nil, status.Errorf(codes.Internal, "response from backend could not be converted internally; this is a bug: %v", err)
 	}
 
 	return outputMsg, nil
 }
+
+func (s *stubImpl) InvokeServerStream(
+	ctx context.Context,
+	invocation *MethodInvocation,
+	opts ...grpc.CallOption) (*ServerStream, error) {
+
+	if !invocation.MethodDescriptor.IsServerStreaming() || invocation.MethodDescriptor.IsClientStreaming() {
+		return nil, status.Errorf(codes.Unimplemented, "method %s is not a server streaming method", invocation.GetFullyQualifiedName())
+	}
+	ss, err := s.stub.InvokeRpcServerStream(ctx,
+		invocation.MethodDescriptor.AsProtoreflectDescriptor(),
+		invocation.Message.AsProtoreflectMessage(), opts...)
+	if err != nil {
+		return nil, status.Convert(err).Err()
+	}
+	return &ServerStream{
+		stream: ss,
+		output: invocation.MethodDescriptor.GetOutputType(),
+	}, nil
+}
+
+// ServerStream is a response stream of a server streaming call, messages are returned as JSON
+type ServerStream struct {
+	stream  *grpcdynamic.ServerStream
+	output  *MessageDescriptor
+	marshal MarshalOptions
+}
+
+// Header returns the header metadata sent by the backend, blocking until it is received
+func (s *ServerStream) Header() (metadata.MD, error) {
+	return s.stream.Header()
+}
+
+// Trailer returns the trailer metadata sent by the backend, only valid after Recv returned an error
+func (s *ServerStream) Trailer() metadata.MD {
+	return s.stream.Trailer()
+}
+
+// Recv returns the next JSON encoded message, io.EOF when the stream completed normally,
+// or the gRPC status error the backend terminated the stream with
+func (s *ServerStream) Recv() ([]byte, error) {
+	o, err := s.stream.RecvMsg()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, status.Convert(err).Err()
+	}
+	outputMsg := s.output.NewMessage()
+	if err = outputMsg.ConvertFrom(o); err != nil {
+		return nil, status.Errorf(codes.Internal, "response from backend could not be converted internally; this is a bug: %v", err)
+	}
+	return outputMsg.MarshalJSONWithOptions(s.marshal)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	rpbv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+)
+
+// registerReflection serves grpc.reflection.v1 and grpc.reflection.v1alpha on s.
+// Both services are answered by the same implementation, the messages of the two versions are identical on the wire
+func registerReflection(s *grpc.Server) {
+	rs := reflection.NewServer(reflection.ServerOptions{Services: s})
+	rpb.RegisterServerReflectionServer(s, rs)
+	rpbv1.RegisterServerReflectionServer(s, &reflectionV1{rs: rs})
+}
+
+// reflectionV1 serves grpc.reflection.v1 by converting the messages to v1alpha
+type reflectionV1 struct {
+	rpbv1.UnimplementedServerReflectionServer
+	rs rpb.ServerReflectionServer
+}
+
+func (r *reflectionV1) ServerReflectionInfo(stream rpbv1.ServerReflection_ServerReflectionInfoServer) error {
+	return r.rs.ServerReflectionInfo(&reflectionV1Stream{ServerStream: stream, stream: stream})
+}
+
+type reflectionV1Stream struct {
+	grpc.ServerStream
+	stream rpbv1.ServerReflection_ServerReflectionInfoServer
+}
+
+func (s *reflectionV1Stream) Send(resp *rpb.ServerReflectionResponse) error {
+	var out rpbv1.ServerReflectionResponse
+	if err := convertMessage(resp, &out); err != nil {
+		return err
+	}
+	return s.stream.Send(&out)
+}
+
+func (s *reflectionV1Stream) Recv() (*rpb.ServerReflectionRequest, error) {
+	req, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	var out rpb.ServerReflectionRequest
+	if err = convertMessage(req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func convertMessage(from, to proto.Message) error {
+	b, err := proto.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, to)
+}
@@ -0,0 +1,170 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/liuyp5181/base/service/proxy"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// OpenAPIPath serves GET /openapi/<service>.json
+	OpenAPIPath = "/openapi/"
+	// SchemaPath serves GET /schema/<message>.json
+	SchemaPath = "/schema/"
+)
+
+// Resolver finds service and message descriptors by fully qualified name
+type Resolver interface {
+	ResolveService(ctx context.Context, name string) (*desc.ServiceDescriptor, error)
+	ResolveMessage(ctx context.Context, name string) (*desc.MessageDescriptor, error)
+}
+
+// LocalResolver resolves the descriptors compiled into the process and those loaded from descriptor set files
+type LocalResolver struct {
+	sync.RWMutex
+	files map[string]*desc.FileDescriptor
+}
+
+func NewLocalResolver() *LocalResolver {
+	return &LocalResolver{
+		files: map[string]*desc.FileDescriptor{},
+	}
+}
+
+// LoadFiles loads descriptor set files as written by protoc --include_imports -o <file>
+func (r *LocalResolver) LoadFiles(paths ...string) error {
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err = proto.Unmarshal(data, &set); err != nil {
+			return fmt.Errorf("parse descriptor set failed, file = %s, err = %v", p, err)
+		}
+		fds, err := desc.CreateFileDescriptorsFromSet(&set)
+		if err != nil {
+			return fmt.Errorf("load descriptor set failed, file = %s, err = %v", p, err)
+		}
+		r.Lock()
+		for name, fd := range fds {
+			r.files[name] = fd
+		}
+		r.Unlock()
+	}
+	return nil
+}
+
+func (r *LocalResolver) ResolveService(ctx context.Context, name string) (*desc.ServiceDescriptor, error) {
+	r.RLock()
+	for _, fd := range r.files {
+		if sd := fd.FindService(name); sd != nil {
+			r.RUnlock()
+			return sd, nil
+		}
+	}
+	r.RUnlock()
+
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	if _, ok := d.(protoreflect.ServiceDescriptor); !ok {
+		return nil, fmt.Errorf("%s is not a service", name)
+	}
+	fd, err := desc.LoadFileDescriptor(d.ParentFile().Path())
+	if err != nil {
+		return nil, err
+	}
+	sd := fd.FindService(name)
+	if sd == nil {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	return sd, nil
+}
+
+func (r *LocalResolver) ResolveMessage(ctx context.Context, name string) (*desc.MessageDescriptor, error) {
+	r.RLock()
+	for _, fd := range r.files {
+		if md := fd.FindMessage(name); md != nil {
+			r.RUnlock()
+			return md, nil
+		}
+	}
+	r.RUnlock()
+
+	md, err := desc.LoadMessageDescriptor(name)
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		return nil, fmt.Errorf("message %s not found", name)
+	}
+	return md, nil
+}
+
+// NewHandler serves the OpenAPI documents and JSON Schemas of the descriptors found by the resolver
+// under OpenAPIPath and SchemaPath
+func NewHandler(r Resolver) http.Handler {
+	return &handler{r: r}
+}
+
+// NewHandlerWithOptions is NewHandler for the messages marshaled with opts, e.g. by a gateway
+// created with WithMarshalOptions
+func NewHandlerWithOptions(r Resolver, opts proxy.MarshalOptions) http.Handler {
+	return &handler{r: r, opts: opts}
+}
+
+type handler struct {
+	r    Resolver
+	opts proxy.MarshalOptions
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var doc map[string]interface{}
+	switch {
+	case strings.HasPrefix(req.URL.Path, OpenAPIPath):
+		name := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, OpenAPIPath), ".json")
+		sd, err := h.r.ResolveService(req.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		doc = OpenAPIWithOptions(sd, h.opts)
+	case strings.HasPrefix(req.URL.Path, SchemaPath):
+		name := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, SchemaPath), ".json")
+		md, err := h.r.ResolveMessage(req.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		doc = JSONSchemaWithOptions(md, h.opts)
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,185 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/liuyp5181/base/service/proxy"
+)
+
+const openAPIVersion = "3.0.3"
+
+var pathVariable = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+// OpenAPI returns an OpenAPI 3 document describing the service as exposed by the gateway:
+// POST /<service>/<method> for every method plus the routes of its google.api.http annotations
+func OpenAPI(sd *desc.ServiceDescriptor) map[string]interface{} {
+	return OpenAPIWithOptions(sd, proxy.MarshalOptions{})
+}
+
+// OpenAPIWithOptions returns the OpenAPI document of the service whose messages are marshaled with opts
+func OpenAPIWithOptions(sd *desc.ServiceDescriptor, opts proxy.MarshalOptions) map[string]interface{} {
+	g := newGenerator("#/components/schemas/", opts)
+	status := g.status()
+
+	var paths = make(map[string]interface{})
+	addOperation := func(path, method string, op map[string]interface{}) {
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(method)] = op
+	}
+
+	for _, md := range sd.GetMethods() {
+		if md.IsClientStreaming() {
+			continue
+		}
+		name := sd.GetFullyQualifiedName()
+		path := "/" + name + "/" + md.GetName()
+		addOperation(path, "POST", g.operation(md, Binding{Method: "POST", Path: path, Body: "*"}, name+"_"+md.GetName(), status))
+
+		rule := HTTPRule(md)
+		if rule == nil {
+			continue
+		}
+		for i, b := range Bindings(rule) {
+			id := fmt.Sprintf("%s_%s_http%d", name, md.GetName(), i)
+			addOperation(pathVariable.ReplaceAllString(b.Path, "{$1}"), b.Method, g.operation(md, b, id, status))
+		}
+	}
+
+	info := map[string]interface{}{
+		"title":   sd.GetFullyQualifiedName(),
+		"version": "1.0.0",
+	}
+	if c := comment(sd.GetSourceInfo()); c != "" {
+		info["description"] = c
+	}
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info":    info,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": g.defs,
+		},
+	}
+}
+
+func (g *generator) operation(md *desc.MethodDescriptor, b Binding, id string, status map[string]interface{}) map[string]interface{} {
+	input := md.GetInputType()
+	op := map[string]interface{}{
+		"operationId": id,
+		"tags":        []string{md.GetService().GetFullyQualifiedName()},
+	}
+	if c := comment(md.GetSourceInfo()); c != "" {
+		op["description"] = c
+	}
+
+	var params []interface{}
+	var bound = make(map[string]bool)
+	for _, m := range pathVariable.FindAllStringSubmatch(b.Path, -1) {
+		bound[m[1]] = true
+		params = append(params, map[string]interface{}{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   g.fieldPath(input, m[1]),
+		})
+	}
+	switch b.Body {
+	case "":
+		// fields not bound by the path are read from the query
+		for _, fd := range input.GetFields() {
+			if bound[fd.GetName()] || bound[fd.GetJSONName()] || fd.GetMessageType() != nil {
+				continue
+			}
+			params = append(params, map[string]interface{}{
+				"name":   fd.GetName(),
+				"in":     "query",
+				"schema": g.field(fd),
+			})
+		}
+	case "*":
+		op["requestBody"] = content("application/json", g.message(input), true)
+	default:
+		op["requestBody"] = content("application/json", g.fieldPath(input, b.Body), true)
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	var resp map[string]interface{}
+	if b.ResponseBody != "" && b.ResponseBody != "*" {
+		resp = g.fieldPath(md.GetOutputType(), b.ResponseBody)
+	} else {
+		resp = g.message(md.GetOutputType())
+	}
+	var ok map[string]interface{}
+	if md.IsServerStreaming() {
+		ok = content("text/event-stream", resp, false)
+		ok["description"] = "stream of server-sent events, one JSON message per event"
+	} else {
+		ok = content("application/json", resp, false)
+		ok["description"] = "OK"
+	}
+	fail := content("application/json", status, false)
+	fail["description"] = "google.rpc.Status of the failed call"
+	op["responses"] = map[string]interface{}{
+		"200":     ok,
+		"default": fail,
+	}
+	return op
+}
+
+// fieldPath returns the schema of the field at the dotted path, or an empty schema when it does not exist
+func (g *generator) fieldPath(md *desc.MessageDescriptor, path string) map[string]interface{} {
+	parts := strings.Split(path, ".")
+	for i, p := range parts {
+		fd := md.FindFieldByName(p)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(p)
+		}
+		if fd == nil {
+			return map[string]interface{}{}
+		}
+		if i == len(parts)-1 {
+			return g.field(fd)
+		}
+		if fd.GetMessageType() == nil {
+			return map[string]interface{}{}
+		}
+		md = fd.GetMessageType()
+	}
+	return map[string]interface{}{}
+}
+
+// status adds the google.rpc.Status schema used for every error response
+func (g *generator) status() map[string]interface{} {
+	const name = "google.rpc.Status"
+	g.defs[name] = map[string]interface{}{
+		"type":  "object",
+		"title": "Status",
+		"properties": map[string]interface{}{
+			"code":    map[string]interface{}{"type": "integer", "format": "int32"},
+			"message": map[string]interface{}{"type": "string"},
+			"details": map[string]interface{}{"type": "array", "items": g.wellKnown("google.protobuf.Any")},
+		},
+	}
+	return map[string]interface{}{"$ref": g.prefix + name}
+}
+
+func content(mime string, schema map[string]interface{}, required bool) map[string]interface{} {
+	c := map[string]interface{}{
+		"content": map[string]interface{}{
+			mime: map[string]interface{}{"schema": schema},
+		},
+	}
+	if required {
+		c["required"] = true
+	}
+	return c
+}
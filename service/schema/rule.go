@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// HTTPRule returns the google.api.http option of the method, nil when there is none
+func HTTPRule(md *desc.MethodDescriptor) *annotations.HttpRule {
+	opts := md.GetMethodOptions()
+	if opts == nil {
+		return nil
+	}
+	// options obtained through reflection may keep the extension as unknown fields, parse them again
+	// against the global registry where the annotations package registered itself
+	b, err := proto.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+	var o descriptorpb.MethodOptions
+	if err = (proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}).Unmarshal(b, &o); err != nil {
+		return nil
+	}
+	if !proto.HasExtension(&o, annotations.E_Http) {
+		return nil
+	}
+	rule, _ := proto.GetExtension(&o, annotations.E_Http).(*annotations.HttpRule)
+	return rule
+}
+
+// Binding is one HTTP method and path of a google.api.http rule
+type Binding struct {
+	Method       string
+	Path         string
+	Body         string
+	ResponseBody string
+}
+
+// Bindings flattens the rule and its additional bindings, rules without a pattern are skipped
+func Bindings(rule *annotations.HttpRule) []Binding {
+	var list []Binding
+	for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		b := Binding{Body: r.GetBody(), ResponseBody: r.GetResponseBody()}
+		switch p := r.GetPattern().(type) {
+		case *annotations.HttpRule_Get:
+			b.Method, b.Path = "GET", p.Get
+		case *annotations.HttpRule_Put:
+			b.Method, b.Path = "PUT", p.Put
+		case *annotations.HttpRule_Post:
+			b.Method, b.Path = "POST", p.Post
+		case *annotations.HttpRule_Delete:
+			b.Method, b.Path = "DELETE", p.Delete
+		case *annotations.HttpRule_Patch:
+			b.Method, b.Path = "PATCH", p.Patch
+		case *annotations.HttpRule_Custom:
+			b.Method, b.Path = p.Custom.GetKind(), p.Custom.GetPath()
+		default:
+			continue
+		}
+		list = append(list, b)
+	}
+	return list
+}
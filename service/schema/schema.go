@@ -0,0 +1,212 @@
+package schema
+
+import (
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/liuyp5181/base/service/proxy"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// generator converts message descriptors to JSON Schema, every message is emitted once into defs
+// and referenced through prefix. The names of the fields, enums and 64 bit integers follow opts
+type generator struct {
+	prefix string
+	defs   map[string]interface{}
+	opts   proxy.MarshalOptions
+}
+
+func newGenerator(prefix string, opts proxy.MarshalOptions) *generator {
+	return &generator{
+		prefix: prefix,
+		defs:   map[string]interface{}{},
+		opts:   opts,
+	}
+}
+
+// JSONSchema returns the JSON Schema of the message in its proto3 JSON mapping
+func JSONSchema(md *desc.MessageDescriptor) map[string]interface{} {
+	return JSONSchemaWithOptions(md, proxy.MarshalOptions{})
+}
+
+// JSONSchemaWithOptions returns the JSON Schema of the message as marshaled with opts
+func JSONSchemaWithOptions(md *desc.MessageDescriptor, opts proxy.MarshalOptions) map[string]interface{} {
+	g := newGenerator("#/$defs/", opts)
+	s := g.message(md)
+	s["$schema"] = jsonSchemaDraft
+	s["$defs"] = g.defs
+	return s
+}
+
+// message returns a reference to the schema of md, adding it to the definitions on first use
+func (g *generator) message(md *desc.MessageDescriptor) map[string]interface{} {
+	if s := g.wellKnown(md.GetFullyQualifiedName()); s != nil {
+		return s
+	}
+	name := md.GetFullyQualifiedName()
+	ref := map[string]interface{}{"$ref": g.prefix + name}
+	if _, ok := g.defs[name]; ok {
+		return ref
+	}
+	// reserve the name first so that recursive messages terminate
+	g.defs[name] = nil
+
+	var props = make(map[string]interface{})
+	var required []string
+	for _, fd := range md.GetFields() {
+		props[g.name(fd)] = g.field(fd)
+		if fd.IsRequired() {
+			required = append(required, g.name(fd))
+		}
+	}
+	s := map[string]interface{}{
+		"type":       "object",
+		"title":      md.GetName(),
+		"properties": props,
+	}
+	if c := comment(md.GetSourceInfo()); c != "" {
+		s["description"] = c
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	g.defs[name] = s
+	return ref
+}
+
+// name returns the JSON key of the field
+func (g *generator) name(fd *desc.FieldDescriptor) string {
+	if g.opts.OrigName {
+		return fd.GetName()
+	}
+	return fd.GetJSONName()
+}
+
+func (g *generator) field(fd *desc.FieldDescriptor) map[string]interface{} {
+	var s map[string]interface{}
+	switch {
+	case fd.IsMap():
+		s = map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.single(fd.GetMapValueType()),
+		}
+	case fd.IsRepeated():
+		s = map[string]interface{}{
+			"type":  "array",
+			"items": g.single(fd),
+		}
+	default:
+		s = g.single(fd)
+	}
+	if c := comment(fd.GetSourceInfo()); c != "" {
+		if _, ok := s["$ref"]; ok {
+			// siblings of $ref are ignored by older tools, wrap it
+			s = map[string]interface{}{"allOf": []interface{}{s}}
+		}
+		s["description"] = c
+	}
+	return s
+}
+
+// single returns the schema of one value of the field, ignoring its cardinality
+func (g *generator) single(fd *desc.FieldDescriptor) map[string]interface{} {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return map[string]interface{}{"type": "integer", "format": "uint32"}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return g.int64("int64")
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return g.int64("uint64")
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return map[string]interface{}{"type": "boolean"}
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return map[string]interface{}{"type": "string"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		if g.opts.EnumsAsInts {
+			var numbers []int32
+			for _, v := range fd.GetEnumType().GetValues() {
+				numbers = append(numbers, v.GetNumber())
+			}
+			return map[string]interface{}{"type": "integer", "format": "int32", "enum": numbers}
+		}
+		var names []string
+		for _, v := range fd.GetEnumType().GetValues() {
+			names = append(names, v.GetName())
+		}
+		return map[string]interface{}{"type": "string", "enum": names}
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return g.message(fd.GetMessageType())
+	}
+	return map[string]interface{}{}
+}
+
+// int64 returns the schema of a 64 bit integer, a string in the proto3 JSON mapping so that clients
+// parsing numbers as doubles do not lose precision, or a number with Int64AsNumbers
+func (g *generator) int64(format string) map[string]interface{} {
+	if g.opts.Int64AsNumbers {
+		return map[string]interface{}{"type": "integer", "format": format}
+	}
+	return map[string]interface{}{"type": "string", "format": format}
+}
+
+// wellKnown returns the schema of the well known types that have a special JSON mapping
+func (g *generator) wellKnown(name string) map[string]interface{} {
+	switch name {
+	case "google.protobuf.Timestamp":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return map[string]interface{}{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`}
+	case "google.protobuf.FieldMask":
+		return map[string]interface{}{"type": "string"}
+	case "google.protobuf.Struct":
+		return map[string]interface{}{"type": "object"}
+	case "google.protobuf.ListValue":
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{}}
+	case "google.protobuf.Value":
+		return map[string]interface{}{}
+	case "google.protobuf.Empty":
+		return map[string]interface{}{"type": "object"}
+	case "google.protobuf.Any":
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           map[string]interface{}{"@type": map[string]interface{}{"type": "string"}},
+			"additionalProperties": true,
+		}
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue":
+		return map[string]interface{}{"type": "number"}
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value":
+		return map[string]interface{}{"type": "integer"}
+	case "google.protobuf.Int64Value":
+		return g.int64("int64")
+	case "google.protobuf.UInt64Value":
+		return g.int64("uint64")
+	case "google.protobuf.BoolValue":
+		return map[string]interface{}{"type": "boolean"}
+	case "google.protobuf.StringValue":
+		return map[string]interface{}{"type": "string"}
+	case "google.protobuf.BytesValue":
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	}
+	return nil
+}
+
+func comment(loc *descriptorpb.SourceCodeInfo_Location) string {
+	return strings.TrimSpace(loc.GetLeadingComments())
+}
@@ -7,12 +7,13 @@ import (
 	"github.com/liuyp5181/base/etcd"
 	"github.com/liuyp5181/base/log"
 	"github.com/liuyp5181/base/service/extend"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/peer"
-	"google.golang.org/grpc/reflection"
 	"net"
+	"time"
 )
 
 const (
@@ -23,10 +24,25 @@ var (
 	version = "1.0.1"
 )
 
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	reflection bool
+}
+
+// WithReflection enables or disables the gRPC reflection services, they are enabled unless
+// server.disable_reflection is set in the config
+func WithReflection(enable bool) ServerOption {
+	return func(o *serverOptions) {
+		o.reflection = enable
+	}
+}
+
 type Server struct {
 	name string
 	sev  *grpc.Server
 	lis  net.Listener
+	reg  *etcd.Registration
 }
 
 func (s *Server) Serve() {
@@ -36,6 +52,21 @@ func (s *Server) Serve() {
 	}
 }
 
+// Stop removes the server from etcd so that clients stop calling it, then stops it gracefully
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.reg.Close(ctx); err != nil {
+		log.Errorf("%s deregister failed, err = %v", s.name, err)
+	}
+	s.sev.GracefulStop()
+}
+
+// GetRegistration returns the etcd registration of the server, e.g. to update its power
+func (s *Server) GetRegistration() *etcd.Registration {
+	return s.reg
+}
+
 func (s *Server) RegisterService(sd *grpc.ServiceDesc, ss interface{}) {
 	s.sev.RegisterService(sd, ss)
 }
@@ -50,13 +81,13 @@ func (s *Server) GetGrpcServer() *grpc.Server {
 
 // UnaryServerInterceptor 拦截器，相对于中间件
 func unaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-	// 扩展字段
+	// 扩展字段，从 traceparent/baggage 继续调用方的链路
+	ctx, span := startRPCSpan(extend.ExtractIncoming(ctx), info.FullMethod, trace.SpanKindServer)
+	defer func() { endRPCSpan(span, err) }()
 	e := extend.NewContext(ctx)
-	var tid = e.GetClient("trace_id")
+	var tid = e.TraceID()
 	var uid = e.GetClient("user_id")
 
-	e.SetClient("trace_id", tid)
-
 	var addr string
 	pr, ok := peer.FromContext(ctx)
 	if ok {
@@ -75,15 +106,51 @@ func unaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.Una
 	return
 }
 
-func NewServer() *Server {
+// serverStream replaces the context of the stream with the one carrying the trace
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := startRPCSpan(extend.ExtractIncoming(ss.Context()), info.FullMethod, trace.SpanKindServer)
+	e := extend.NewContext(ctx)
+	var tid = e.TraceID()
+	var uid = e.GetClient("user_id")
+
+	log.Infof("stream   [%s] %s %s", tid, uid, info.FullMethod)
+
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	if err != nil {
+		log.Errorf("handler  [%s] %s %s err: %+v", tid, uid, info.FullMethod, err)
+	}
+	endRPCSpan(span, err)
+	return err
+}
+
+func NewServer(opts ...ServerOption) *Server {
 	name := config.ServiceName
-	serverCfg := config.GetConfig().Server
+	serverCfg := config.Get().Server
+
+	o := serverOptions{reflection: !serverCfg.DisableReflection}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	err := etcd.SetService(name, serverCfg.IP, serverCfg.Port, version, 100)
+	reg, err := etcd.SetService(name, serverCfg.IP, serverCfg.Port, version, 100)
 	if err != nil {
 		panic(err)
 	}
 
+	// 集群内唯一的 worker id，用于 Snowflake id
+	if _, err := etcd.RegisterWorkerID(); err != nil {
+		panic(fmt.Sprintf("register worker id failed, err = %v", err))
+	}
+
 	listen, err := net.Listen("tcp", fmt.Sprintf("%s:%d", serverCfg.IP, serverCfg.Port))
 	if err != nil {
 		panic(err)
@@ -91,14 +158,18 @@ func NewServer() *Server {
 
 	s := &Server{
 		name: name,
-		sev:  grpc.NewServer(grpc.UnaryInterceptor(unaryServerInterceptor)),
+		reg:  reg,
+		sev:  grpc.NewServer(grpc.UnaryInterceptor(unaryServerInterceptor), grpc.StreamInterceptor(streamServerInterceptor)),
 		lis:  listen,
 	}
 
 	// grpc反射
 	// server端：从中获取所有的可变和不可变的服务，遍历获取所有的服务、方法、属性，添加到相应的对象中
 	// client端：根据请求参数进行判断，使用不同的方法处理，并返回响应
-	reflection.Register(s)
+	// 同时提供 v1 和 v1alpha 两个版本
+	if o.reflection {
+		registerReflection(s.sev)
+	}
 
 	// 心跳
 	hs := health.NewServer()
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/liuyp5181/base/service/extend"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// clientStream stores the headers and trailers of the stream in the Extend of the call and ends
+// the span once the stream is finished: after the last message, on an error, or when the context
+// of the call is done without a final RecvMsg
+type clientStream struct {
+	grpc.ClientStream
+	desc   *grpc.StreamDesc
+	span   trace.Span
+	ext    *extend.Extend
+	header sync.Once
+	once   sync.Once
+	done   chan struct{}
+}
+
+func newClientStream(ctx context.Context, cs grpc.ClientStream, desc *grpc.StreamDesc, span trace.Span, ext *extend.Extend) *clientStream {
+	s := &clientStream{ClientStream: cs, desc: desc, span: span, ext: ext, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.finish(ctx.Err(), false)
+		case <-s.done:
+		}
+	}()
+	return s
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	// the header is received before the first message, so Header does not block here
+	s.loadHeader()
+	if err != nil {
+		s.end(err)
+	} else if !s.desc.ServerStreams {
+		// the single response of a unary or client streaming call ends the stream, e.g. CloseAndRecv
+		s.end(nil)
+	}
+	return err
+}
+
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.end(err)
+		return md, err
+	}
+	if s.ext != nil {
+		s.header.Do(func() {
+			*s.ext.MD = md
+		})
+	}
+	return md, nil
+}
+
+func (s *clientStream) loadHeader() {
+	if s.ext == nil {
+		return
+	}
+	s.header.Do(func() {
+		md, _ := s.ClientStream.Header()
+		*s.ext.MD = md
+	})
+}
+
+func (s *clientStream) end(err error) {
+	s.finish(err, true)
+}
+
+// finish ends the span once, the trailer is only read when the stream has completed
+func (s *clientStream) finish(err error, trailer bool) {
+	s.once.Do(func() {
+		close(s.done)
+		if s.ext != nil && trailer {
+			*s.ext.Trailer = s.ClientStream.Trailer()
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		endRPCSpan(s.span, err)
+	})
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/liuyp5181/base/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// startRPCSpan starts the span of a gRPC call, fullMethod is /package.Service/Method
+func startRPCSpan(ctx context.Context, fullMethod string, kind trace.SpanKind) (context.Context, trace.Span) {
+	name := strings.TrimPrefix(fullMethod, "/")
+	var attrs = []attribute.KeyValue{attribute.String("rpc.system", "grpc")}
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		attrs = append(attrs, attribute.String("rpc.service", name[:i]), attribute.String("rpc.method", name[i+1:]))
+	}
+	return tracing.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+func endRPCSpan(span trace.Span, err error) {
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(status.Code(err))))
+	tracing.End(span, err)
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/liuyp5181/base/service/extend"
+	"github.com/liuyp5181/base/signal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/liuyp5181/base"
+	defaultEndpoint     = "localhost:4317"
+	shutdownTimeout     = 5 * time.Second
+)
+
+type Config struct {
+	// Exporter is "otlp" or "stdout", tracing is disabled when empty
+	Exporter string `mapstructure:"exporter" validate:"oneof=otlp stdout"`
+	// Endpoint is the address of the OTLP gRPC collector, localhost:4317 by default
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure disables TLS to the collector
+	Insecure bool `mapstructure:"insecure"`
+	// SampleRatio is the ratio of new traces that are recorded, 1 when 0.
+	// Traces continued from a caller follow the sampled flag of the caller
+	SampleRatio float64 `mapstructure:"sample_ratio" validate:"min=0,max=1"`
+}
+
+var enabled bool
+
+// Init installs the tracer provider exporting the spans of service as configured
+func Init(cfg *Config, service, namespace string) error {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "":
+		return nil
+	case "otlp":
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = defaultEndpoint
+		}
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err = otlptracegrpc.New(context.Background(), opts...)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return fmt.Errorf("not found exporter = %v", cfg.Exporter)
+	}
+	if err != nil {
+		return fmt.Errorf("create %s exporter failed, err = %v", cfg.Exporter, err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(service),
+		semconv.ServiceNamespace(namespace),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled = true
+
+	signal.RegisterClose(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		tp.Shutdown(ctx)
+	})
+	return nil
+}
+
+// Enabled reports whether spans are exported
+func Enabled() bool {
+	return enabled
+}
+
+// Tracer returns the tracer of the instrumented packages
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span as a child of the trace carried by ctx, see extend.TraceFromContext.
+// The returned context carries the span both for OpenTelemetry and for extend, so that the span
+// is the parent of the calls propagated from it. When tracing is disabled the span does not record
+// and extend still gets a new span id
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent, ok := extend.TraceFromContext(ctx)
+	if ok {
+		psc := toSpanContext(parent)
+		if cur := trace.SpanContextFromContext(ctx); cur.TraceID() != psc.TraceID() || cur.SpanID() != psc.SpanID() {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, psc)
+		}
+	}
+
+	ctx, span := Tracer().Start(ctx, name, opts...)
+	sc := span.SpanContext()
+	if sc.IsValid() && (!ok || [8]byte(sc.SpanID()) != parent.SpanID) {
+		return extend.WithTrace(ctx, extend.TraceContext{
+			TraceID: sc.TraceID(),
+			SpanID:  sc.SpanID(),
+			Flags:   byte(sc.TraceFlags()),
+			State:   sc.TraceState().String(),
+		}), span
+	}
+	return extend.StartSpan(ctx), span
+}
+
+// End records err on the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func toSpanContext(t extend.TraceContext) trace.SpanContext {
+	ts, _ := trace.ParseTraceState(t.State)
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    t.TraceID,
+		SpanID:     t.SpanID,
+		TraceFlags: trace.TraceFlags(t.Flags),
+		TraceState: ts,
+		Remote:     true,
+	})
+}
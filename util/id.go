@@ -1,11 +1,15 @@
 package util
 
 import (
-	"fmt"
-	"hash/crc32"
-	"time"
+	"strconv"
 )
 
+// GenerateId returns prefix followed by a Snowflake id of the default generator, data is no longer used
 func GenerateId(prefix string, data interface{}) string {
-	return fmt.Sprintf("%s%d%d", prefix, crc32.ChecksumIEEE([]byte(fmt.Sprintf("%v", data)))%1000, time.Now().In(time.Local).UnixNano())
+	id, err := NextID()
+	if err != nil {
+		// no worker id is leased or the clock moved back, a ULID stays unique without the generator state
+		return prefix + NewULID()
+	}
+	return prefix + strconv.FormatInt(id, 10)
 }
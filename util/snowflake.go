@@ -0,0 +1,131 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	workerBits   = 10
+	sequenceBits = 12
+	// MaxWorkerID is the largest worker id of a Snowflake
+	MaxWorkerID  = 1<<workerBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+	workerShift  = sequenceBits
+	timeShift    = sequenceBits + workerBits
+	maxClockWait = 10 * time.Millisecond
+)
+
+// SnowflakeEpoch is the time of the timestamp 0 of the ids, 2023-01-01 UTC
+var SnowflakeEpoch = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	// ErrClockBackwards is returned when the clock moved back further than the generator waits for
+	ErrClockBackwards = errors.New("clock moved backwards")
+	// ErrWorkerNotSet is returned by NextID before a worker id is set and after it is cleared
+	ErrWorkerNotSet = errors.New("snowflake worker id is not set")
+)
+
+// Snowflake generates 64 bit ids ordered by time: 41 bits of milliseconds since SnowflakeEpoch,
+// 10 bits of worker id and 12 bits of sequence. Two generators never return the same id as long as
+// their worker ids differ
+type Snowflake struct {
+	sync.Mutex
+	worker   int64
+	last     int64
+	sequence int64
+}
+
+func NewSnowflake(worker int64) (*Snowflake, error) {
+	if worker < 0 || worker > MaxWorkerID {
+		return nil, fmt.Errorf("worker id %d out of range [0, %d]", worker, MaxWorkerID)
+	}
+	return &Snowflake{worker: worker}, nil
+}
+
+// Next returns the next id. When the clock moved back it waits up to 10ms for it to catch up with the
+// last id, and returns ErrClockBackwards beyond that
+func (s *Snowflake) Next() (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.worker < 0 {
+		return 0, ErrWorkerNotSet
+	}
+
+	now := sinceEpoch()
+	if now < s.last {
+		if time.Duration(s.last-now)*time.Millisecond > maxClockWait {
+			return 0, fmt.Errorf("%w by %dms", ErrClockBackwards, s.last-now)
+		}
+		time.Sleep(time.Duration(s.last-now) * time.Millisecond)
+		now = sinceEpoch()
+		if now < s.last {
+			return 0, fmt.Errorf("%w by %dms", ErrClockBackwards, s.last-now)
+		}
+	}
+
+	if now == s.last {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			// sequence exhausted, wait for the next millisecond
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = sinceEpoch()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.last = now
+	return now<<timeShift | s.worker<<workerShift | s.sequence, nil
+}
+
+// Worker returns the worker id of the generator
+func (s *Snowflake) Worker() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.worker
+}
+
+// setWorker changes the worker id, the ids stay ordered by time
+func (s *Snowflake) setWorker(worker int64) {
+	s.Lock()
+	s.worker = worker
+	s.Unlock()
+}
+
+func sinceEpoch() int64 {
+	return time.Since(SnowflakeEpoch).Milliseconds()
+}
+
+// ParseSnowflake returns the time, worker id and sequence of a Snowflake id
+func ParseSnowflake(id int64) (time.Time, int64, int64) {
+	ms := id >> timeShift
+	return SnowflakeEpoch.Add(time.Duration(ms) * time.Millisecond), id >> workerShift & MaxWorkerID, id & maxSequence
+}
+
+// defaultSnowflake has no worker id until SetWorkerID sets one that is unique in the cluster, a random
+// one could be held by another process
+var defaultSnowflake = &Snowflake{worker: -1}
+
+// SetWorkerID sets the worker id of the default generator, see etcd.RegisterWorkerID
+func SetWorkerID(worker int64) error {
+	if worker < 0 || worker > MaxWorkerID {
+		return fmt.Errorf("worker id %d out of range [0, %d]", worker, MaxWorkerID)
+	}
+	defaultSnowflake.setWorker(worker)
+	return nil
+}
+
+// ClearWorkerID removes the worker id of the default generator, e.g. when its lease is lost, NextID
+// returns ErrWorkerNotSet until SetWorkerID is called again
+func ClearWorkerID() {
+	defaultSnowflake.setWorker(-1)
+}
+
+// NextID returns the next id of the default generator, or ErrWorkerNotSet when it has no worker id
+func NextID() (int64, error) {
+	return defaultSnowflake.Next()
+}
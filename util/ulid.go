@@ -0,0 +1,121 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	base62    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// ksuidEpoch is the KSUID timestamp 0, 2014-05-13 16:53:20 UTC
+	ksuidEpoch = 1400000000
+	ksuidLen   = 27
+)
+
+var ulidState struct {
+	sync.Mutex
+	last    uint64
+	entropy [10]byte
+}
+
+// NewULID returns a ULID: 26 characters of Crockford base32, sortable by their millisecond timestamp.
+// Ids of the same millisecond increase monotonically within the process
+func NewULID() string {
+	ms := uint64(time.Now().UnixMilli())
+
+	ulidState.Lock()
+	if ms <= ulidState.last {
+		// same millisecond, or the clock moved back: keep the last timestamp and increment the entropy
+		ms = ulidState.last
+		for i := len(ulidState.entropy) - 1; i >= 0; i-- {
+			ulidState.entropy[i]++
+			if ulidState.entropy[i] != 0 {
+				break
+			}
+		}
+	} else {
+		rand.Read(ulidState.entropy[:])
+	}
+	ulidState.last = ms
+	var b [16]byte
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	copy(b[6:], ulidState.entropy[:])
+	ulidState.Unlock()
+
+	return encodeULID(b)
+}
+
+func encodeULID(b [16]byte) string {
+	// 128 bits in 26 characters of 5 bits, the first character holds the top 3 bits
+	n := new(big.Int).SetBytes(b[:])
+	var out [26]byte
+	mask := big.NewInt(31)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 5)
+	}
+	return string(out[:])
+}
+
+// ULIDTime returns the timestamp of a ULID
+func ULIDTime(id string) (time.Time, error) {
+	// the first character holds the top 3 bits of the 48 bit timestamp
+	if len(id) != 26 || id[0] > '7' {
+		return time.Time{}, fmt.Errorf("invalid ulid %q", id)
+	}
+	var ms uint64
+	for _, c := range id[:10] {
+		i := strings.IndexByte(crockford, byte(c))
+		if i < 0 {
+			return time.Time{}, fmt.Errorf("invalid ulid %q", id)
+		}
+		ms = ms<<5 | uint64(i)
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// NewKSUID returns a KSUID: 27 characters of base62, a 32 bit timestamp in seconds followed by 128 random bits
+func NewKSUID() string {
+	var b [20]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	rand.Read(b[4:])
+
+	n := new(big.Int).SetBytes(b[:])
+	var out = make([]byte, ksuidLen)
+	base := big.NewInt(62)
+	mod := new(big.Int)
+	for i := ksuidLen - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = base62[mod.Int64()]
+	}
+	return string(out)
+}
+
+// KSUIDTime returns the timestamp of a KSUID
+func KSUIDTime(id string) (time.Time, error) {
+	if len(id) != ksuidLen {
+		return time.Time{}, fmt.Errorf("invalid ksuid %q", id)
+	}
+	n := new(big.Int)
+	base := big.NewInt(62)
+	for _, c := range id {
+		i := strings.IndexByte(base62, byte(c))
+		if i < 0 {
+			return time.Time{}, fmt.Errorf("invalid ksuid %q", id)
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(i)))
+	}
+	// 27 characters of base62 hold more than the 160 bits of a KSUID
+	if n.BitLen() > 160 {
+		return time.Time{}, fmt.Errorf("invalid ksuid %q", id)
+	}
+	var b [20]byte
+	n.FillBytes(b[:])
+	return time.Unix(int64(binary.BigEndian.Uint32(b[:4]))+ksuidEpoch, 0), nil
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewULID(t *testing.T) {
+	start := time.Now().Truncate(time.Millisecond)
+	var ids = make([]string, 1000)
+	for i := range ids {
+		ids[i] = NewULID()
+	}
+	end := time.Now()
+
+	if !sort.StringsAreSorted(ids) {
+		t.Fatal("ULIDs of the process are not increasing")
+	}
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			t.Fatalf("duplicate ULID %s", id)
+		}
+		ts, err := ULIDTime(id)
+		if err != nil {
+			t.Fatalf("ULIDTime(%s) err = %v", id, err)
+		}
+		if ts.Before(start) || ts.After(end) {
+			t.Fatalf("ULIDTime(%s) = %v, not between %v and %v", id, ts, start, end)
+		}
+	}
+}
+
+func TestULIDTime(t *testing.T) {
+	valid := map[string]time.Time{
+		"00000000000000000000000000": time.UnixMilli(0),
+		"01ARZ3NDEKTSV4RRFFQ69G5FAV": time.UnixMilli(1469922850259),
+		"7ZZZZZZZZZZZZZZZZZZZZZZZZZ": time.UnixMilli(1<<48 - 1),
+	}
+	for id, want := range valid {
+		if got, err := ULIDTime(id); err != nil || !got.Equal(want) {
+			t.Errorf("ULIDTime(%s) = %v, %v, want %v", id, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"01ARZ3NDEKTSV4RRFFQ69G5FA",
+		"01ARZ3NDEKTSV4RRFFQ69G5FAVX",
+		// U is not in the Crockford alphabet
+		"01ARZ3NDEUTSV4RRFFQ69G5FAV",
+		// above the 128 bits of a ULID
+		"8ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+		"ZZZZZZZZZZZZZZZZZZZZZZZZZZ",
+	}
+	for _, id := range invalid {
+		if got, err := ULIDTime(id); err == nil {
+			t.Errorf("ULIDTime(%q) = %v, want an error", id, got)
+		}
+	}
+}
+
+func TestNewKSUID(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	id := NewKSUID()
+	end := time.Now()
+
+	if len(id) != ksuidLen {
+		t.Fatalf("len(%s) = %d, want %d", id, len(id), ksuidLen)
+	}
+	ts, err := KSUIDTime(id)
+	if err != nil {
+		t.Fatalf("KSUIDTime(%s) err = %v", id, err)
+	}
+	if ts.Before(start) || ts.After(end) {
+		t.Fatalf("KSUIDTime(%s) = %v, not between %v and %v", id, ts, start, end)
+	}
+}
+
+func TestKSUIDTime(t *testing.T) {
+	valid := map[string]time.Time{
+		strings.Repeat("0", ksuidLen): time.Unix(ksuidEpoch, 0),
+		"0ujtsYcgvSTl8PAuAdqWYSMnLOv": time.Unix(1507608047, 0),
+		"aWgEPTl1tmebfsQzFP4bxwgy80V": time.Unix(1<<32-1+ksuidEpoch, 0),
+	}
+	for id, want := range valid {
+		if got, err := KSUIDTime(id); err != nil || !got.Equal(want) {
+			t.Errorf("KSUIDTime(%s) = %v, %v, want %v", id, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"0ujtsYcgvSTl8PAuAdqWYSMnLO",
+		"0ujtsYcgvSTl8PAuAdqWYSMnLO-",
+		// above the 160 bits of a KSUID
+		"aWgEPTl1tmebfsQzFP4bxwgy80W",
+		strings.Repeat("z", ksuidLen),
+	}
+	for _, id := range invalid {
+		if got, err := KSUIDTime(id); err == nil {
+			t.Errorf("KSUIDTime(%q) = %v, want an error", id, got)
+		}
+	}
+}